@@ -0,0 +1,359 @@
+package alerts
+
+import (
+	"fmt"
+	"path"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/byuoitav/common/nerr"
+)
+
+// Level is the severity of an alert
+type Level int
+
+const (
+	// Normal means the metric is within its thresholds
+	Normal Level = iota
+
+	// Warning means the metric has crossed its warning threshold
+	Warning
+
+	// Critical means the metric has crossed its critical threshold
+	Critical
+)
+
+// String .
+func (l Level) String() string {
+	switch l {
+	case Warning:
+		return "warning"
+	case Critical:
+		return "critical"
+	default:
+		return "normal"
+	}
+}
+
+// MarshalText .
+func (l Level) MarshalText() ([]byte, error) {
+	return []byte(l.String()), nil
+}
+
+// Thresholds are the warning and critical values for a condition
+type Thresholds struct {
+	Warning  *float64 `json:"warning,omitempty"`
+	Critical *float64 `json:"critical,omitempty"`
+}
+
+// Rule describes when a metric should raise an alert
+type Rule struct {
+	Name string `json:"name"`
+
+	// Metric is the name of the metric to watch. it may be a glob (ie, "*-temp") to watch several metrics at once
+	Metric string `json:"metric"`
+
+	// Comparison is ">" (the default) to alert when the metric goes above a threshold, or "<" to alert when it goes below
+	Comparison string `json:"comparison,omitempty"`
+
+	Thresholds
+
+	// For is how long a threshold must be crossed before the alert is raised (ie, "5m")
+	For string `json:"for,omitempty"`
+
+	// Hysteresis is how far back past a threshold the metric must go before the alert is lowered or cleared
+	Hysteresis float64 `json:"hysteresis,omitempty"`
+
+	// Rate is an alert on how fast the metric is changing
+	Rate *RateCondition `json:"rate,omitempty"`
+
+	forDuration time.Duration
+	ratePer     time.Duration
+}
+
+// RateCondition alerts when the change of a metric per a duration crosses a threshold.
+// the rate is compared using the rule's comparison, so a "<" rule needs negative thresholds to alert on a falling metric.
+type RateCondition struct {
+	// Per is the duration the rate is measured over (ie, "1m"). defaults to 1m
+	Per string `json:"per,omitempty"`
+
+	Thresholds
+}
+
+// Alert is a change in the level of a metric
+type Alert struct {
+	Rule      string    `json:"rule"`
+	Metric    string    `json:"metric"`
+	Level     Level     `json:"level"`
+	Previous  Level     `json:"previous-level"`
+	Value     float64   `json:"value"`
+	Rate      *float64  `json:"rate,omitempty"`
+	Reason    string    `json:"reason,omitempty"`
+	Timestamp time.Time `json:"timestamp"`
+
+	// Since is when the metric entered its previous level
+	Since time.Time `json:"since"`
+}
+
+// Cleared returns true if the alert is a metric returning to normal
+func (a Alert) Cleared() bool {
+	return a.Level == Normal
+}
+
+type state struct {
+	rule   string
+	metric string
+
+	level Level
+	since time.Time
+
+	pending      Level
+	pendingSince time.Time
+
+	lastValue float64
+	lastTime  time.Time
+}
+
+// Engine evaluates rules against metrics, and remembers the state of each metric between evaluations
+type Engine struct {
+	states map[string]*state
+	mu     sync.Mutex
+}
+
+// NewEngine .
+func NewEngine() *Engine {
+	return &Engine{
+		states: make(map[string]*state),
+	}
+}
+
+// Validate checks that the rule is valid, and parses its durations
+func (r *Rule) Validate() *nerr.E {
+	if len(r.Name) == 0 {
+		return nerr.Create("rule is missing a name", "invalid")
+	}
+
+	if _, err := path.Match(r.Metric, ""); err != nil || len(r.Metric) == 0 {
+		return nerr.Createf("invalid", "rule %s has an invalid metric '%s'", r.Name, r.Metric)
+	}
+
+	switch r.Comparison {
+	case "":
+		r.Comparison = ">"
+	case ">", "<":
+	default:
+		return nerr.Createf("invalid", "rule %s has an invalid comparison '%s'", r.Name, r.Comparison)
+	}
+
+	if len(r.For) > 0 {
+		d, err := time.ParseDuration(r.For)
+		if err != nil {
+			return nerr.Translate(err).Addf("rule %s has an invalid duration", r.Name)
+		}
+
+		r.forDuration = d
+	}
+
+	if r.Rate != nil {
+		r.ratePer = time.Minute
+		if len(r.Rate.Per) > 0 {
+			d, err := time.ParseDuration(r.Rate.Per)
+			if err != nil || d <= 0 {
+				return nerr.Createf("invalid", "rule %s has an invalid rate duration '%s'", r.Name, r.Rate.Per)
+			}
+
+			r.ratePer = d
+		}
+	}
+
+	return nil
+}
+
+// Evaluate checks each rule against values, and returns an alert for each metric whose level changed.
+// a metric that had raised an alert on one of rules is cleared once it is missing from values, unless it's in unknown
+// (ie, it couldn't be measured this time), in which case its state is kept as is
+func (e *Engine) Evaluate(rules []Rule, values map[string]float64, unknown map[string]bool, at time.Time) ([]Alert, *nerr.E) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	// evaluate the metrics in a consistent order
+	names := make([]string, 0, len(values))
+	for name := range values {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var alerts []Alert
+	evaluated := make(map[string]bool)
+	ruleNames := make(map[string]bool)
+
+	for i := range rules {
+		rule := rules[i]
+		if err := rule.Validate(); err != nil {
+			return alerts, err.Addf("unable to evaluate alert rules")
+		}
+
+		ruleNames[rule.Name] = true
+
+		for _, name := range names {
+			if ok, _ := path.Match(rule.Metric, name); !ok {
+				continue
+			}
+
+			evaluated[rule.Name+"|"+name] = true
+
+			if alert := e.evaluate(rule, name, values[name], at); alert != nil {
+				alerts = append(alerts, *alert)
+			}
+		}
+	}
+
+	alerts = append(alerts, e.expire(ruleNames, evaluated, unknown, at)...)
+	return alerts, nil
+}
+
+// expire forgets the state of each metric of rules that wasn't evaluated because it's no longer reported,
+// clearing the ones that had raised an alert
+func (e *Engine) expire(rules, evaluated, unknown map[string]bool, at time.Time) []Alert {
+	var keys []string
+	for key, s := range e.states {
+		if rules[s.rule] && !evaluated[key] && !unknown[s.metric] {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	var alerts []Alert
+	for _, key := range keys {
+		s := e.states[key]
+		delete(e.states, key)
+
+		if s.level == Normal {
+			continue
+		}
+
+		alerts = append(alerts, Alert{
+			Rule:      s.rule,
+			Metric:    s.metric,
+			Level:     Normal,
+			Previous:  s.level,
+			Value:     s.lastValue,
+			Reason:    "the metric is no longer reported",
+			Timestamp: at,
+			Since:     s.since,
+		})
+	}
+
+	return alerts
+}
+
+func (e *Engine) evaluate(rule Rule, metric string, value float64, at time.Time) *Alert {
+	key := rule.Name + "|" + metric
+
+	s, ok := e.states[key]
+	if !ok {
+		s = &state{
+			rule:   rule.Name,
+			metric: metric,
+			since:  at,
+		}
+
+		e.states[key] = s
+	}
+
+	level, reason := rule.thresholdLevel(value, s.level)
+
+	// check how fast the metric is changing
+	var rate *float64
+	if rule.Rate != nil && !s.lastTime.IsZero() && at.After(s.lastTime) {
+		r := (value - s.lastValue) / float64(at.Sub(s.lastTime)) * float64(rule.ratePer)
+		rate = &r
+
+		if rlevel := rule.levelOf(r, rule.Rate.Thresholds, Normal, 0); rlevel > level {
+			level = rlevel
+			reason = fmt.Sprintf("changing by %.2f per %v", r, rule.ratePer)
+		}
+	}
+
+	s.lastValue = value
+	s.lastTime = at
+
+	if level == s.level {
+		s.pending = s.level
+		return nil
+	}
+
+	// raising an alert has to wait until the level has been held long enough
+	if level > s.level && rule.forDuration > 0 {
+		if s.pending != level {
+			s.pending = level
+			s.pendingSince = at
+		}
+
+		if at.Sub(s.pendingSince) < rule.forDuration {
+			return nil
+		}
+	}
+
+	alert := &Alert{
+		Rule:      rule.Name,
+		Metric:    metric,
+		Level:     level,
+		Previous:  s.level,
+		Value:     value,
+		Rate:      rate,
+		Reason:    reason,
+		Timestamp: at,
+		Since:     s.since,
+	}
+
+	s.level = level
+	s.since = at
+	s.pending = level
+
+	return alert
+}
+
+// thresholdLevel returns the level of value, applying hysteresis to the current level
+func (r Rule) thresholdLevel(value float64, current Level) (Level, string) {
+	level := r.levelOf(value, r.Thresholds, current, r.Hysteresis)
+
+	switch level {
+	case Critical:
+		return level, fmt.Sprintf("%v %s critical threshold %v", value, r.Comparison, *r.Critical)
+	case Warning:
+		return level, fmt.Sprintf("%v %s warning threshold %v", value, r.Comparison, *r.Warning)
+	default:
+		return level, ""
+	}
+}
+
+func (r Rule) levelOf(value float64, t Thresholds, current Level, hysteresis float64) Level {
+	crossed := func(threshold *float64, level Level) bool {
+		if threshold == nil {
+			return false
+		}
+
+		// once a level has been reached, the metric has to go hysteresis past the threshold to leave it
+		h := 0.0
+		if current >= level {
+			h = hysteresis
+		}
+
+		if r.Comparison == "<" {
+			return value < *threshold+h
+		}
+
+		return value > *threshold-h
+	}
+
+	switch {
+	case crossed(t.Critical, Critical):
+		return Critical
+	case crossed(t.Warning, Warning):
+		return Warning
+	default:
+		return Normal
+	}
+}
@@ -9,7 +9,6 @@ import (
 	"io/ioutil"
 	"net/http"
 	"os"
-	"os/exec"
 	"regexp"
 	"strings"
 )
@@ -26,34 +25,16 @@ type socketResponse struct {
 	NumSockets uint `json:"ClientCount"`
 }
 
-const configPath = "/home/pi/.i3/config"
+// i3ConfigPath is where the browser's launch command is read from if none is configured
+const i3ConfigPath = "/home/pi/.i3/config"
 
-// CheckWebSocketCount checks the web socket count and restarts the browser if the count is 0
-func CheckWebSocketCount(ctx context.Context, configs []ServiceConfig) (bool, error) {
-	for _, config := range configs {
-		if config.Method == "" {
-			config.Method = "GET"
-		}
-		resp, err := makeRequest(config.Method, config.URL)
-		if err != nil {
-			return false, err
-		}
-
-		if resp.NumSockets == 0 {
-			err = restartBrowser()
-			return true, err
-		}
-	}
-	return false, nil
-}
-
-func makeRequest(method, url string) (*socketResponse, error) {
+func makeRequest(ctx context.Context, method, url string) (*socketResponse, error) {
 	req, err := http.NewRequest(method, url, nil)
 	if err != nil {
 		return nil, err
 	}
 
-	resp, err := http.DefaultClient.Do(req)
+	resp, err := http.DefaultClient.Do(req.WithContext(ctx))
 	if err != nil {
 		return nil, err
 	}
@@ -77,58 +58,36 @@ func makeRequest(method, url string) (*socketResponse, error) {
 	return &responseBody, nil
 }
 
-func restartBrowser() error {
-	err := killChromium()
-	// if err != nil {
-	// 	return err
-	// }
-
-	//find i3 config file
-	file, err := os.Open(configPath)
+// i3Command returns the command on the last line of the i3 config, which is how the browser has always been launched
+func i3Command() ([]string, error) {
+	file, err := os.Open(i3ConfigPath)
 	if err != nil {
-		return err
+		return nil, err
 	}
-
-	fileIn := bufio.NewReader(file)
+	defer file.Close()
 
 	//get the last line
-	lastLine, err := readLastLine(fileIn)
+	lastLine, err := readLastLine(bufio.NewReader(file))
 	if err != nil {
-		return err
+		return nil, err
 	}
 	lastLine = strings.TrimSuffix(lastLine, "\n")
 
 	//parse the last line
 	regex, err := regexp.Compile(` \S*\'.*\'| \S+`)
 	if err != nil {
-		return err
+		return nil, err
 	}
 	tokens := regex.FindAllString(lastLine, -1)
 	for i, tok := range tokens {
 		tokens[i] = strings.TrimPrefix(tok, " ")
 	}
 
-	command := []string{"sudo", "-H", "-u", "pi"}
-	command = append(command, tokens...)
-
-	args := command[1:]
-
-	//run the last line as a bash command with exec
-	cmd := exec.Command(command[0], args...)
-	cmd.Env = os.Environ()
-	cmd.Env = append(cmd.Env, "DISPLAY=:0")
-
-	err = cmd.Start()
-	if err != nil {
-		return err
+	if len(tokens) == 0 {
+		return nil, fmt.Errorf("no command found in %s", i3ConfigPath)
 	}
 
-	return nil
-}
-
-func killChromium() error {
-	cmd := exec.Command("pkill", "-o", "chromium")
-	return cmd.Run()
+	return tokens, nil
 }
 
 func readLastLine(r *bufio.Reader) (string, error) {
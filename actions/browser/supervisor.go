@@ -0,0 +1,402 @@
+package browser
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"os"
+	"os/exec"
+	"os/user"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/byuoitav/common/log"
+	"github.com/byuoitav/common/nerr"
+	"github.com/byuoitav/device-monitoring/audit"
+)
+
+const (
+	defaultUser          = "pi"
+	defaultDisplay       = ":0"
+	defaultProcess       = "chromium"
+	defaultVerifyTimeout = time.Minute
+	defaultMinBackoff    = time.Minute
+	defaultMaxBackoff    = 30 * time.Minute
+	defaultStableAfter   = 10 * time.Minute
+
+	killTimeout  = 10 * time.Second
+	pollInterval = 2 * time.Second
+)
+
+// Config is how the browser is launched, restarted, and checked
+type Config struct {
+	// Command launches the browser (ie, ["chromium-browser", "--kiosk", "http://localhost:8888"]).
+	// if neither it nor Unit is set, the last line of the i3 config is used
+	Command []string `json:"command,omitempty"`
+
+	// User, Display, and Env are who the browser runs as and its environment. User defaults to pi, and Display to :0
+	User    string            `json:"user,omitempty"`
+	Display string            `json:"display,omitempty"`
+	Env     map[string]string `json:"env,omitempty"`
+
+	// Unit is a systemd unit that runs the browser. if it's set, the browser is restarted with systemctl instead of Command.
+	// UserUnit means it's a unit of User's systemd instance
+	Unit     string `json:"unit,omitempty"`
+	UserUnit bool   `json:"user-unit,omitempty"`
+
+	// Process is the name of the browser's process. defaults to chromium
+	Process string `json:"process,omitempty"`
+
+	// Services are checked for connected websockets. the browser is restarted if any of them have none
+	Services []ServiceConfig `json:"services,omitempty"`
+
+	// VerifyTimeout is how long to wait for the browser to come back after restarting it. defaults to 1m
+	VerifyTimeout string `json:"verify-timeout,omitempty"`
+
+	// MinBackoff and MaxBackoff are how long to wait before restarting the browser again.
+	// the wait doubles with each restart, until the browser has been healthy for StableAfter. they default to 1m, 30m, and 10m
+	MinBackoff  string `json:"min-backoff,omitempty"`
+	MaxBackoff  string `json:"max-backoff,omitempty"`
+	StableAfter string `json:"stable-after,omitempty"`
+
+	verifyTimeout time.Duration
+	minBackoff    time.Duration
+	maxBackoff    time.Duration
+	stableAfter   time.Duration
+}
+
+// Result is the outcome of checking the browser
+type Result struct {
+	Healthy bool   `json:"healthy"`
+	Reason  string `json:"reason,omitempty"`
+
+	// Restarted is true if the browser was restarted, and Verified is true if it came back afterwards
+	Restarted bool   `json:"restarted"`
+	Verified  bool   `json:"verified"`
+	Method    string `json:"method,omitempty"`
+	Error     string `json:"error,omitempty"`
+
+	// NextRestart is the soonest the browser will be restarted again
+	NextRestart *time.Time `json:"next-restart,omitempty"`
+}
+
+// Status is the history of the browser's restarts
+type Status struct {
+	Restarts            int       `json:"restarts"`
+	ConsecutiveRestarts int       `json:"consecutive-restarts"`
+	LastRestart         time.Time `json:"last-restart,omitempty"`
+	LastReason          string    `json:"last-reason,omitempty"`
+	LastVerified        bool      `json:"last-verified"`
+	NextAllowed         time.Time `json:"next-allowed,omitempty"`
+
+	// Restarting is true while the browser is being restarted and verified
+	Restarting bool `json:"restarting"`
+}
+
+var (
+	status   Status
+	statusMu sync.Mutex
+)
+
+// GetStatus returns the history of the browser's restarts
+func GetStatus() Status {
+	statusMu.Lock()
+	defer statusMu.Unlock()
+
+	return status
+}
+
+func (c *Config) setDefaults() *nerr.E {
+	if len(c.User) == 0 {
+		c.User = defaultUser
+	}
+
+	if len(c.Display) == 0 {
+		c.Display = defaultDisplay
+	}
+
+	if len(c.Process) == 0 {
+		c.Process = defaultProcess
+	}
+
+	durations := []struct {
+		s   string
+		d   *time.Duration
+		def time.Duration
+	}{
+		{c.VerifyTimeout, &c.verifyTimeout, defaultVerifyTimeout},
+		{c.MinBackoff, &c.minBackoff, defaultMinBackoff},
+		{c.MaxBackoff, &c.maxBackoff, defaultMaxBackoff},
+		{c.StableAfter, &c.stableAfter, defaultStableAfter},
+	}
+
+	for _, d := range durations {
+		*d.d = d.def
+		if len(d.s) == 0 {
+			continue
+		}
+
+		var err error
+		*d.d, err = time.ParseDuration(d.s)
+		if err != nil {
+			return nerr.Translate(err).Addf("invalid duration %q", d.s)
+		}
+	}
+
+	return nil
+}
+
+// Supervise checks that the browser is running and connected to each service, and restarts it if it isn't.
+// restarts back off while the browser keeps failing, so that it isn't restarted in a loop
+func Supervise(ctx context.Context, config Config) (Result, *nerr.E) {
+	var result Result
+
+	if err := config.setDefaults(); err != nil {
+		return result, err.Addf("unable to check browser")
+	}
+
+	reason, err := check(ctx, config)
+	if err != nil {
+		return result, err.Addf("unable to check browser")
+	}
+
+	now := time.Now()
+
+	// the lock is only held while status is read or updated, so GetStatus doesn't wait on a restart
+	statusMu.Lock()
+
+	if len(reason) == 0 {
+		result.Healthy = true
+
+		if status.ConsecutiveRestarts > 0 && !status.Restarting && now.Sub(status.LastRestart) >= config.stableAfter {
+			log.L.Infof("Browser has been healthy for %v, resetting restart backoff", config.stableAfter)
+			status.ConsecutiveRestarts = 0
+		}
+
+		statusMu.Unlock()
+		return result, nil
+	}
+
+	result.Reason = reason
+
+	if status.Restarting || now.Before(status.NextAllowed) {
+		log.L.Infof("Browser is unhealthy (%s), but it was restarted recently; waiting until %s", reason, status.NextAllowed.Format(time.RFC3339))
+
+		next := status.NextAllowed
+		statusMu.Unlock()
+
+		result.NextRestart = &next
+		return result, nil
+	}
+
+	backoff := time.Duration(float64(config.minBackoff) * math.Pow(2, float64(status.ConsecutiveRestarts)))
+	if backoff > config.maxBackoff || backoff <= 0 {
+		backoff = config.maxBackoff
+	}
+
+	// claim the restart before unlocking, so that a concurrent check doesn't restart the browser again
+	status.Restarting = true
+	status.Restarts++
+	status.ConsecutiveRestarts++
+	status.LastRestart = now
+	status.LastReason = reason
+	status.NextAllowed = now.Add(backoff)
+
+	next := status.NextAllowed
+	statusMu.Unlock()
+
+	result.NextRestart = &next
+
+	log.L.Infof("Restarting browser: %s", reason)
+
+	result.Restarted = true
+	result.Method, err = restart(ctx, config)
+
+	params := map[string]string{
+		"reason": reason,
+		"method": result.Method,
+	}
+
+	if err != nil {
+		audit.Record("browser-restart", "browser-supervisor", params, err)
+		result.Error = err.Error()
+	} else {
+		audit.Record("browser-restart", "browser-supervisor", params, nil)
+		result.Verified, result.Error = verify(ctx, config)
+	}
+
+	statusMu.Lock()
+	status.Restarting = false
+	status.LastVerified = result.Verified
+	statusMu.Unlock()
+
+	if err != nil {
+		return result, err.Addf("unable to restart browser")
+	}
+
+	return result, nil
+}
+
+// check returns why the browser is unhealthy, or an empty string if it's healthy
+func check(ctx context.Context, config Config) (string, *nerr.E) {
+	if !running(ctx, config) {
+		return fmt.Sprintf("%s isn't running", config.Process), nil
+	}
+
+	for _, service := range config.Services {
+		if len(service.Method) == 0 {
+			service.Method = "GET"
+		}
+
+		resp, err := makeRequest(ctx, service.Method, service.URL)
+		if err != nil {
+			return "", nerr.Translate(err).Addf("unable to get websocket count from %s", service.Name)
+		}
+
+		if resp.NumSockets == 0 {
+			return fmt.Sprintf("no websockets are connected to %s", service.Name), nil
+		}
+	}
+
+	return "", nil
+}
+
+// verify waits for the browser to be running and connected to each service again
+func verify(ctx context.Context, config Config) (bool, string) {
+	ctx, cancel := context.WithTimeout(ctx, config.verifyTimeout)
+	defer cancel()
+
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+
+	reason := ""
+	for {
+		select {
+		case <-ctx.Done():
+			log.L.Warnf("Browser didn't come back after %v: %s", config.verifyTimeout, reason)
+			return false, fmt.Sprintf("browser didn't come back after %v: %s", config.verifyTimeout, reason)
+		case <-ticker.C:
+		}
+
+		var err *nerr.E
+
+		reason, err = check(ctx, config)
+		switch {
+		case err != nil:
+			reason = err.Error()
+		case len(reason) == 0:
+			log.L.Infof("Browser is back")
+			return true, ""
+		}
+	}
+}
+
+// restart restarts the browser, returning how it was restarted
+func restart(ctx context.Context, config Config) (string, *nerr.E) {
+	if len(config.Unit) > 0 {
+		return "systemd", restartUnit(ctx, config)
+	}
+
+	command := config.Command
+	method := "command"
+
+	if len(command) == 0 {
+		var err error
+
+		command, err = i3Command()
+		if err != nil {
+			return "i3", nerr.Translate(err).Addf("no browser command is configured, and it couldn't be read from the i3 config")
+		}
+
+		method = "i3"
+	}
+
+	if err := kill(ctx, config); err != nil {
+		return method, err
+	}
+
+	// sudo clears the environment, so it's passed through env
+	args := []string{"-H", "-u", config.User, "env", "DISPLAY=" + config.Display}
+
+	var keys []string
+	for k := range config.Env {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		args = append(args, k+"="+config.Env[k])
+	}
+
+	args = append(args, command...)
+
+	// the browser should outlive this request, so it isn't tied to ctx
+	cmd := exec.Command("sudo", args...)
+	cmd.Env = os.Environ()
+
+	log.L.Infof("Launching browser: %s", strings.Join(cmd.Args, " "))
+
+	if err := cmd.Start(); err != nil {
+		return method, nerr.Translate(err).Addf("unable to launch browser")
+	}
+
+	// reap the browser when it exits
+	go cmd.Wait()
+
+	return method, nil
+}
+
+func restartUnit(ctx context.Context, config Config) *nerr.E {
+	cmd := exec.CommandContext(ctx, "sudo", "systemctl", "restart", config.Unit)
+
+	if config.UserUnit {
+		u, err := user.Lookup(config.User)
+		if err != nil {
+			return nerr.Translate(err).Addf("unable to find user %s", config.User)
+		}
+
+		cmd = exec.CommandContext(ctx, "sudo", "-H", "-u", config.User, "env", "XDG_RUNTIME_DIR=/run/user/"+u.Uid,
+			"systemctl", "--user", "restart", config.Unit)
+	}
+
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return nerr.Translate(err).Addf("unable to restart %s: %s", config.Unit, strings.TrimSpace(string(out)))
+	}
+
+	return nil
+}
+
+// kill stops the browser, forcing it if it doesn't exit on its own
+func kill(ctx context.Context, config Config) *nerr.E {
+	if !running(ctx, config) {
+		return nil
+	}
+
+	// the oldest process is the browser's main process; the rest exit with it
+	if err := exec.CommandContext(ctx, "sudo", "pkill", "-o", "-u", config.User, config.Process).Run(); err != nil {
+		log.L.Warnf("unable to stop %s: %s", config.Process, err)
+	}
+
+	deadline := time.Now().Add(killTimeout)
+	for time.Now().Before(deadline) {
+		if !running(ctx, config) {
+			return nil
+		}
+
+		time.Sleep(500 * time.Millisecond)
+	}
+
+	log.L.Warnf("%s didn't exit after %v, killing it", config.Process, killTimeout)
+
+	if err := exec.CommandContext(ctx, "sudo", "pkill", "-KILL", "-u", config.User, config.Process).Run(); err != nil {
+		return nerr.Translate(err).Addf("unable to kill %s", config.Process)
+	}
+
+	return nil
+}
+
+func running(ctx context.Context, config Config) bool {
+	return exec.CommandContext(ctx, "pgrep", "-u", config.User, config.Process).Run() == nil
+}
@@ -0,0 +1,319 @@
+package dns
+
+import (
+	"context"
+	"io/ioutil"
+	"net"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/byuoitav/common/db"
+	"github.com/byuoitav/common/nerr"
+	"github.com/byuoitav/common/structs"
+)
+
+const (
+	resolvConfPath = "/etc/resolv.conf"
+
+	// SystemResolver is the name used for the system's resolver when no nameservers are found
+	SystemResolver = "system"
+)
+
+// CheckConfig is what a dns check resolves
+type CheckConfig struct {
+	Names []NameConfig `json:"names,omitempty"`
+
+	// Nameservers are the servers to query. defaults to the ones in /etc/resolv.conf
+	Nameservers []string `json:"nameservers,omitempty"`
+
+	// CheckDevices compares the address each device in the room resolves to with its address in the database
+	CheckDevices bool `json:"check-devices,omitempty"`
+
+	// Domain is added to device ids to get their hostname (ie, .byu.edu)
+	Domain string `json:"domain,omitempty"`
+}
+
+// NameConfig is a name to resolve
+type NameConfig struct {
+	Name string `json:"name"`
+
+	// Expected are the addresses the name should resolve to. if it's empty, any answer is ok
+	Expected []string `json:"expected,omitempty"`
+}
+
+// NameResult is the result of resolving a name against one nameserver
+type NameResult struct {
+	Name       string   `json:"name"`
+	Nameserver string   `json:"nameserver"`
+	Addresses  []string `json:"addresses,omitempty"`
+	Latency    string   `json:"latency"`
+	Expected   []string `json:"expected,omitempty"`
+	Matches    bool     `json:"matches"`
+	Error      string   `json:"error,omitempty"`
+
+	latency time.Duration
+}
+
+// DeviceResult is the result of resolving the hostname of a device in the room
+type DeviceResult struct {
+	Device     string   `json:"device"`
+	Hostname   string   `json:"hostname"`
+	Address    string   `json:"address"`
+	Nameserver string   `json:"nameserver"`
+	Resolved   []string `json:"resolved,omitempty"`
+	Matches    bool     `json:"matches"`
+	Error      string   `json:"error,omitempty"`
+}
+
+// Check is the result of a dns check
+type Check struct {
+	Timestamp   time.Time      `json:"timestamp"`
+	Healthy     bool           `json:"healthy"`
+	Nameservers []string       `json:"nameservers"`
+	Names       []NameResult   `json:"names,omitempty"`
+	Devices     []DeviceResult `json:"devices,omitempty"`
+}
+
+// Duration returns how long the lookup took
+func (r NameResult) Duration() time.Duration {
+	return r.latency
+}
+
+// RunCheck resolves each name and device against each nameserver
+func RunCheck(ctx context.Context, roomID string, config CheckConfig) (Check, *nerr.E) {
+	check := Check{
+		Timestamp:   time.Now(),
+		Healthy:     true,
+		Nameservers: config.Nameservers,
+	}
+
+	if len(check.Nameservers) == 0 {
+		check.Nameservers = systemNameservers()
+	}
+
+	resolvers := make(map[string]*net.Resolver)
+	for _, ns := range check.Nameservers {
+		resolvers[ns] = resolverFor(ns)
+	}
+
+	// validate and look everything up before starting any lookups
+	for _, name := range config.Names {
+		if len(name.Name) == 0 {
+			return check, nerr.Create("name to resolve is missing", "invalid")
+		}
+	}
+
+	var devices []structs.Device
+	if config.CheckDevices {
+		var err error
+
+		devices, err = db.GetDB().GetDevicesByRoom(roomID)
+		if err != nil {
+			return check, nerr.Translate(err).Addf("unable to get devices in room %s", roomID)
+		}
+	}
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+
+	for _, name := range config.Names {
+		for ns, resolver := range resolvers {
+			wg.Add(1)
+
+			go func(name NameConfig, ns string, resolver *net.Resolver) {
+				defer wg.Done()
+
+				res := resolveName(ctx, resolver, ns, name)
+
+				mu.Lock()
+				defer mu.Unlock()
+
+				check.Names = append(check.Names, res)
+				if !res.Matches {
+					check.Healthy = false
+				}
+			}(name, ns, resolver)
+		}
+	}
+
+	for i := range devices {
+		if len(devices[i].Address) == 0 || devices[i].Address == "0.0.0.0" {
+			continue
+		}
+
+		for ns, resolver := range resolvers {
+			wg.Add(1)
+
+			go func(id, address, ns string, resolver *net.Resolver) {
+				defer wg.Done()
+
+				res := resolveDevice(ctx, resolver, ns, id, address, config.Domain)
+
+				mu.Lock()
+				defer mu.Unlock()
+
+				check.Devices = append(check.Devices, res)
+				if !res.Matches {
+					check.Healthy = false
+				}
+			}(devices[i].ID, devices[i].Address, ns, resolver)
+		}
+	}
+
+	wg.Wait()
+
+	sort.Slice(check.Names, func(i, j int) bool {
+		if check.Names[i].Name == check.Names[j].Name {
+			return check.Names[i].Nameserver < check.Names[j].Nameserver
+		}
+
+		return check.Names[i].Name < check.Names[j].Name
+	})
+
+	sort.Slice(check.Devices, func(i, j int) bool {
+		if check.Devices[i].Device == check.Devices[j].Device {
+			return check.Devices[i].Nameserver < check.Devices[j].Nameserver
+		}
+
+		return check.Devices[i].Device < check.Devices[j].Device
+	})
+
+	return check, nil
+}
+
+func resolveName(ctx context.Context, resolver *net.Resolver, ns string, name NameConfig) NameResult {
+	start := time.Now()
+	res := Resolve(ctx, resolver, name.Name)
+
+	result := NameResult{
+		Name:       name.Name,
+		Nameserver: ns,
+		Addresses:  res.Addresses,
+		Latency:    res.Latency,
+		Expected:   name.Expected,
+		Error:      res.Error,
+		latency:    time.Since(start),
+	}
+
+	if len(result.Error) > 0 {
+		return result
+	}
+
+	result.Matches = len(name.Expected) == 0 || sameAddresses(result.Addresses, name.Expected)
+	return result
+}
+
+func resolveDevice(ctx context.Context, resolver *net.Resolver, ns, id, address, domain string) DeviceResult {
+	result := DeviceResult{
+		Device:     id,
+		Hostname:   strings.ToLower(id) + domain,
+		Address:    address,
+		Nameserver: ns,
+	}
+
+	res := Resolve(ctx, resolver, result.Hostname)
+	if len(res.Error) > 0 {
+		result.Error = res.Error
+		return result
+	}
+
+	result.Resolved = res.Addresses
+
+	// the address in the database might be a hostname too
+	expected := []string{address}
+	if net.ParseIP(address) == nil {
+		addr := Resolve(ctx, resolver, address)
+		if len(addr.Error) > 0 {
+			result.Error = "unable to resolve database address: " + addr.Error
+			return result
+		}
+
+		expected = addr.Addresses
+	}
+
+	result.Matches = sameAddresses(result.Resolved, expected)
+	return result
+}
+
+// resolverFor returns a resolver that only queries nameserver
+func resolverFor(nameserver string) *net.Resolver {
+	if nameserver == SystemResolver {
+		return net.DefaultResolver
+	}
+
+	addr := nameserver
+	if _, _, err := net.SplitHostPort(addr); err != nil {
+		addr = net.JoinHostPort(addr, "53")
+	}
+
+	return &net.Resolver{
+		PreferGo: true,
+		Dial: func(ctx context.Context, network, _ string) (net.Conn, error) {
+			var d net.Dialer
+			return d.DialContext(ctx, network, addr)
+		},
+	}
+}
+
+// systemNameservers returns the nameservers in /etc/resolv.conf
+func systemNameservers() []string {
+	b, err := ioutil.ReadFile(resolvConfPath)
+	if err != nil {
+		return []string{SystemResolver}
+	}
+
+	var nameservers []string
+	for _, line := range strings.Split(string(b), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) >= 2 && fields[0] == "nameserver" {
+			nameservers = append(nameservers, fields[1])
+		}
+	}
+
+	if len(nameservers) == 0 {
+		return []string{SystemResolver}
+	}
+
+	return nameservers
+}
+
+// sameAddresses returns true if every address in a is in b. addresses in a of a family (ipv4/ipv6) that isn't in b are ignored,
+// so that a name with ipv6 answers can still match an ipv4 address in the database
+func sameAddresses(a, b []string) bool {
+	expected := make(map[string]bool)
+	families := make(map[bool]bool)
+
+	for _, addr := range b {
+		if ip := net.ParseIP(addr); ip != nil {
+			addr = ip.String()
+			families[isIPv4(ip)] = true
+		}
+
+		expected[addr] = true
+	}
+
+	compared := 0
+	for _, addr := range a {
+		if ip := net.ParseIP(addr); ip != nil {
+			if !families[isIPv4(ip)] {
+				continue
+			}
+
+			addr = ip.String()
+		}
+
+		if !expected[addr] {
+			return false
+		}
+
+		compared++
+	}
+
+	return compared > 0
+}
+
+func isIPv4(ip net.IP) bool {
+	return ip.To4() != nil
+}
@@ -0,0 +1,162 @@
+package dns
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/byuoitav/common/log"
+	"github.com/byuoitav/common/nerr"
+	"github.com/byuoitav/device-monitoring/localsystem"
+)
+
+// Resolver is a local dns cache that can be flushed
+type Resolver struct {
+	Name string
+
+	// Unit is the systemd unit the resolver runs as
+	Unit string
+
+	// Flush is the command that flushes its cache
+	Flush []string
+}
+
+// Resolvers are the local resolvers that are flushed if they are running
+var Resolvers = []Resolver{
+	{
+		Name:  "dnsmasq",
+		Unit:  "dnsmasq",
+		Flush: []string{"sudo", "systemctl", "restart", "dnsmasq"},
+	},
+	{
+		Name:  "systemd-resolved",
+		Unit:  "systemd-resolved",
+		Flush: []string{"sudo", "resolvectl", "flush-caches"},
+	},
+	{
+		Name:  "nscd",
+		Unit:  "nscd",
+		Flush: []string{"sudo", "nscd", "--invalidate=hosts"},
+	},
+}
+
+// FlushResult is the result of flushing a resolver
+type FlushResult struct {
+	Resolver string            `json:"resolver"`
+	Before   *localsystem.Unit `json:"before,omitempty"`
+	After    *localsystem.Unit `json:"after,omitempty"`
+	Command  string            `json:"command"`
+	Success  bool              `json:"success"`
+	Stderr   string            `json:"stderr,omitempty"`
+	Error    string            `json:"error,omitempty"`
+}
+
+// Resolution is the result of resolving a name
+type Resolution struct {
+	Name      string   `json:"name"`
+	Addresses []string `json:"addresses,omitempty"`
+	Latency   string   `json:"latency"`
+	Error     string   `json:"error,omitempty"`
+}
+
+// Flush is the result of flushing every running resolver
+type Flush struct {
+	Timestamp time.Time     `json:"timestamp"`
+	Success   bool          `json:"success"`
+	Resolvers []FlushResult `json:"resolvers"`
+
+	// Verified is the result of resolving each name after the caches were flushed
+	Verified []Resolution `json:"verified,omitempty"`
+}
+
+const verifyTimeout = 5 * time.Second
+
+// FlushCache flushes the cache of every local resolver that's running, then checks that each of names still resolves.
+// it's successful if every flush succeeded and every name resolved
+func FlushCache(ctx context.Context, names []string) (Flush, *nerr.E) {
+	flush := Flush{
+		Timestamp: time.Now(),
+		Success:   true,
+	}
+
+	for _, r := range Resolvers {
+		before, err := localsystem.UnitStatus(ctx, r.Unit)
+		if err != nil || before.ActiveState != "active" {
+			continue
+		}
+
+		result := FlushResult{
+			Resolver: r.Name,
+			Before:   &before,
+			Command:  strings.Join(r.Flush, " "),
+		}
+
+		var stderr bytes.Buffer
+		cmd := exec.CommandContext(ctx, r.Flush[0], r.Flush[1:]...)
+		cmd.Stderr = &stderr
+
+		if err := cmd.Run(); err != nil {
+			result.Error = err.Error()
+			result.Stderr = strings.TrimSpace(stderr.String())
+			flush.Success = false
+
+			log.L.Warnf("failed to flush %s: %s (%s)", r.Name, err, result.Stderr)
+		} else {
+			result.Success = true
+		}
+
+		if after, err := localsystem.UnitStatus(ctx, r.Unit); err != nil {
+			result.Error = fmt.Sprintf("%s; unable to get status after flush: %s", result.Error, err.Error())
+		} else {
+			result.After = &after
+
+			if after.ActiveState != "active" {
+				result.Success = false
+				flush.Success = false
+			}
+		}
+
+		flush.Resolvers = append(flush.Resolvers, result)
+	}
+
+	if len(flush.Resolvers) == 0 {
+		return flush, nerr.Create("no local dns resolvers are running", "not-found")
+	}
+
+	for _, name := range names {
+		res := Resolve(ctx, net.DefaultResolver, name)
+		if len(res.Error) > 0 {
+			flush.Success = false
+		}
+
+		flush.Verified = append(flush.Verified, res)
+	}
+
+	return flush, nil
+}
+
+// Resolve looks up name with resolver, and measures how long it took
+func Resolve(ctx context.Context, resolver *net.Resolver, name string) Resolution {
+	ctx, cancel := context.WithTimeout(ctx, verifyTimeout)
+	defer cancel()
+
+	res := Resolution{
+		Name: name,
+	}
+
+	start := time.Now()
+	addrs, err := resolver.LookupHost(ctx, name)
+	res.Latency = time.Since(start).String()
+
+	if err != nil {
+		res.Error = err.Error()
+		return res
+	}
+
+	res.Addresses = addrs
+	return res
+}
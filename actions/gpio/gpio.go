@@ -14,6 +14,7 @@ import (
 
 	"github.com/byuoitav/common/log"
 	"github.com/byuoitav/device-monitoring/localsystem"
+	"github.com/byuoitav/device-monitoring/metrics"
 	"gobot.io/x/gobot/drivers/gpio"
 	"gobot.io/x/gobot/platforms/raspi"
 )
@@ -74,6 +75,8 @@ func (p *Pin) Monitor() {
 		trueUpDuration = 5 * time.Minute // default true up duration
 	}
 
+	metrics.DividerConnected(strconv.Itoa(p.Pin), p.Connected)
+
 	newStateCount := 0
 	readTick := time.NewTicker(readDuration)
 	trueUpTick := time.NewTicker(trueUpDuration)
@@ -103,6 +106,7 @@ func (p *Pin) Monitor() {
 
 					p.Connected = connected
 					log.L.Infof("changed state to %v", p.Connected)
+					metrics.DividerConnected(strconv.Itoa(p.Pin), p.Connected)
 
 					for i := range p.ChangeRequests {
 						go p.ChangeRequests[i].execute(p)
@@ -0,0 +1,291 @@
+package hardwareinfo
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/byuoitav/common/log"
+	"github.com/byuoitav/common/nerr"
+	"github.com/byuoitav/device-monitoring/localsystem"
+)
+
+const (
+	defaultHistoryFile         = "hardware-history.json"
+	defaultHistoryMaxSamples   = 2016 // one week of samples every 5 minutes
+	defaultHistorySaveInterval = 15 * time.Minute
+)
+
+// HistoryConfig controls where the hardware history is persisted and how much of it is kept
+type HistoryConfig struct {
+	// Path is where the history is saved. relative paths are in the data directory
+	Path         string `json:"path,omitempty"`
+	MaxSamples   int    `json:"max-samples,omitempty"`
+	SaveInterval string `json:"save-interval,omitempty"`
+}
+
+// Sample is the value of each hardware metric at a point in time
+type Sample struct {
+	Timestamp time.Time          `json:"timestamp"`
+	Values    map[string]float64 `json:"values"`
+}
+
+// Point is the value of a single metric over a step of time
+type Point struct {
+	Timestamp time.Time `json:"timestamp"`
+	Value     float64   `json:"value"`
+	Min       float64   `json:"min"`
+	Max       float64   `json:"max"`
+	Samples   int       `json:"samples"`
+}
+
+// HardwareHistory is a bounded ring buffer of hardware samples that is periodically persisted to disk
+type HardwareHistory struct {
+	path         string
+	saveInterval time.Duration
+	lastSave     time.Time
+
+	samples []Sample
+	next    int
+	full    bool
+	mu      sync.RWMutex
+}
+
+var (
+	historyOnce sync.Once
+	history     *HardwareHistory
+)
+
+// History returns the hardware history, loading it from disk the first time it is called
+func History() *HardwareHistory {
+	historyOnce.Do(func() {
+		history = &HardwareHistory{
+			path:         localsystem.DataPath(defaultHistoryFile),
+			saveInterval: defaultHistorySaveInterval,
+			samples:      make([]Sample, defaultHistoryMaxSamples),
+		}
+
+		if err := history.load(); err != nil {
+			log.L.Warnf("unable to load hardware history: %s", err.Error())
+		}
+	})
+
+	return history
+}
+
+// Configure updates the history's settings. if the path changes, the history is reloaded from the new path.
+func (h *HardwareHistory) Configure(config HistoryConfig) *nerr.E {
+	h.mu.Lock()
+
+	if len(config.SaveInterval) > 0 {
+		d, err := time.ParseDuration(config.SaveInterval)
+		if err != nil {
+			h.mu.Unlock()
+			return nerr.Translate(err).Addf("invalid save interval '%s'", config.SaveInterval)
+		}
+
+		h.saveInterval = d
+	}
+
+	if config.MaxSamples > 0 && config.MaxSamples != len(h.samples) {
+		h.resize(config.MaxSamples)
+	}
+
+	var reload bool
+	if len(config.Path) > 0 {
+		path := localsystem.DataPath(config.Path)
+		reload = path != h.path
+		h.path = path
+	}
+
+	h.mu.Unlock()
+
+	if reload {
+		return h.load()
+	}
+
+	return nil
+}
+
+// Add adds a sample to the history, and saves the history to disk if it hasn't been saved recently
+func (h *HardwareHistory) Add(sample Sample) {
+	h.mu.Lock()
+	h.samples[h.next] = sample
+	h.next = (h.next + 1) % len(h.samples)
+	if h.next == 0 {
+		h.full = true
+	}
+
+	save := time.Since(h.lastSave) >= h.saveInterval
+	h.mu.Unlock()
+
+	if save {
+		if err := h.Save(); err != nil {
+			log.L.Warnf("unable to save hardware history: %s", err.Error())
+		}
+	}
+}
+
+// Samples returns every sample taken since the given time, oldest first
+func (h *HardwareHistory) Samples(since time.Time) []Sample {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	samples := []Sample{}
+	for _, s := range h.ordered() {
+		if !s.Timestamp.Before(since) {
+			samples = append(samples, s)
+		}
+	}
+
+	return samples
+}
+
+// Metrics returns the names of every metric in the history
+func (h *HardwareHistory) Metrics() []string {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	seen := make(map[string]bool)
+	for _, s := range h.ordered() {
+		for name := range s.Values {
+			seen[name] = true
+		}
+	}
+
+	names := []string{}
+	for name := range seen {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+	return names
+}
+
+// Query returns the values of metric since the given time. if step is greater than zero,
+// the samples are downsampled into one point per step, averaging the values in each step.
+func (h *HardwareHistory) Query(metric string, since time.Time, step time.Duration) []Point {
+	points := []Point{}
+
+	for _, s := range h.Samples(since) {
+		v, ok := s.Values[metric]
+		if !ok {
+			continue
+		}
+
+		ts := s.Timestamp
+		if step > 0 {
+			ts = since.Add(s.Timestamp.Sub(since) / step * step)
+		}
+
+		if len(points) > 0 && points[len(points)-1].Timestamp.Equal(ts) {
+			p := &points[len(points)-1]
+			p.Value = (p.Value*float64(p.Samples) + v) / float64(p.Samples+1)
+			p.Samples++
+
+			if v < p.Min {
+				p.Min = v
+			}
+
+			if v > p.Max {
+				p.Max = v
+			}
+
+			continue
+		}
+
+		points = append(points, Point{
+			Timestamp: ts,
+			Value:     v,
+			Min:       v,
+			Max:       v,
+			Samples:   1,
+		})
+	}
+
+	return points
+}
+
+// Save writes the history to disk
+func (h *HardwareHistory) Save() *nerr.E {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	b, err := json.Marshal(h.ordered())
+	if err != nil {
+		return nerr.Translate(err).Addf("failed to save hardware history")
+	}
+
+	if dir := filepath.Dir(h.path); len(dir) > 0 {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return nerr.Translate(err).Addf("failed to save hardware history")
+		}
+	}
+
+	// write to a temp file first so that a power loss doesn't corrupt the history
+	tmp := h.path + ".tmp"
+	if err := ioutil.WriteFile(tmp, b, 0644); err != nil {
+		return nerr.Translate(err).Addf("failed to save hardware history")
+	}
+
+	if err := os.Rename(tmp, h.path); err != nil {
+		return nerr.Translate(err).Addf("failed to save hardware history")
+	}
+
+	h.lastSave = time.Now()
+	return nil
+}
+
+func (h *HardwareHistory) load() *nerr.E {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	// don't try to save again until the next interval
+	h.lastSave = time.Now()
+
+	b, err := ioutil.ReadFile(h.path)
+	switch {
+	case os.IsNotExist(err):
+		return nil
+	case err != nil:
+		return nerr.Translate(err).Addf("failed to load hardware history from %s", h.path)
+	}
+
+	var samples []Sample
+	if err := json.Unmarshal(b, &samples); err != nil {
+		return nerr.Translate(err).Addf("failed to load hardware history from %s", h.path)
+	}
+
+	h.fill(samples, len(h.samples))
+	log.L.Infof("Loaded %v hardware history samples from %s", len(samples), h.path)
+	return nil
+}
+
+// ordered returns the samples in the order they were added. h.mu must be held.
+func (h *HardwareHistory) ordered() []Sample {
+	if !h.full {
+		return h.samples[:h.next]
+	}
+
+	return append(append([]Sample{}, h.samples[h.next:]...), h.samples[:h.next]...)
+}
+
+// resize changes the max number of samples, keeping the newest ones. h.mu must be held.
+func (h *HardwareHistory) resize(size int) {
+	h.fill(h.ordered(), size)
+}
+
+// fill replaces the buffer with one of the given size containing the newest of samples. h.mu must be held.
+func (h *HardwareHistory) fill(samples []Sample, size int) {
+	if len(samples) > size {
+		samples = samples[len(samples)-size:]
+	}
+
+	h.samples = make([]Sample, size)
+	h.next = copy(h.samples, samples) % size
+	h.full = len(samples) == size
+}
@@ -1,62 +1,316 @@
 package hardwareinfo
 
 import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
 	"github.com/byuoitav/common/log"
 	"github.com/byuoitav/common/nerr"
 	"github.com/byuoitav/device-monitoring/localsystem"
 )
 
+const (
+	// SchemaVersion is the version of the HardwareInfo json schema.
+	// it should be incremented whenever a field is removed or changes meaning.
+	SchemaVersion = 2
+
+	// collectorTimeout is how long each section of the hardware info has to be collected
+	collectorTimeout = 20 * time.Second
+)
+
 // HardwareInfo .
 type HardwareInfo struct {
-	Host    map[string]interface{} `json:"host,omitempty"`
-	Memory  map[string]interface{} `json:"memory,omitempty"`
-	CPU     map[string]interface{} `json:"cpu,omitempty"`
-	Disk    map[string]interface{} `json:"disk,omitempty"`
-	Network map[string]interface{} `json:"network,omitempty"`
-	Docker  map[string]interface{} `json:"docker,omitempty"`
-	Procs   map[string]interface{} `json:"procs,omitempty"`
+	Version int `json:"version"`
+
+	Host    *localsystem.Host      `json:"host,omitempty"`
+	Memory  *localsystem.Memory    `json:"memory,omitempty"`
+	CPU     *localsystem.CPU       `json:"cpu,omitempty"`
+	Disk    *localsystem.Disk      `json:"disk,omitempty"`
+	Network *localsystem.Network   `json:"network,omitempty"`
+	Docker  *localsystem.Docker    `json:"docker,omitempty"`
+	Procs   *localsystem.Processes `json:"procs,omitempty"`
+
+	Pi *localsystem.PiHealth `json:"pi,omitempty"`
+
+	// Errors is the error from each section that couldn't be collected
+	Errors map[string]string `json:"errors,omitempty"`
+}
+
+// collector gathers one section of HardwareInfo. it returns a function that adds the section to the info
+type collector struct {
+	name    string
+	collect func(ctx context.Context) (func(*HardwareInfo), *nerr.E)
 }
 
-// PiInfo .
-func PiInfo() (HardwareInfo, *nerr.E) {
+type collected struct {
+	name  string
+	apply func(*HardwareInfo)
+	err   error
+}
+
+var collectors = []collector{
+	{"cpu", func(ctx context.Context) (func(*HardwareInfo), *nerr.E) {
+		cpu, err := localsystem.CPUInfo()
+		return func(info *HardwareInfo) { info.CPU = &cpu }, err
+	}},
+	{"memory", func(ctx context.Context) (func(*HardwareInfo), *nerr.E) {
+		memory, err := localsystem.MemoryInfo()
+		return func(info *HardwareInfo) { info.Memory = &memory }, err
+	}},
+	{"host", func(ctx context.Context) (func(*HardwareInfo), *nerr.E) {
+		host, err := localsystem.HostInfo()
+		return func(info *HardwareInfo) { info.Host = &host }, err
+	}},
+	{"disk", func(ctx context.Context) (func(*HardwareInfo), *nerr.E) {
+		disk, err := localsystem.DiskInfo(ctx)
+		return func(info *HardwareInfo) { info.Disk = &disk }, err
+	}},
+	{"network", func(ctx context.Context) (func(*HardwareInfo), *nerr.E) {
+		network, err := localsystem.NetworkInfo()
+		return func(info *HardwareInfo) { info.Network = &network }, err
+	}},
+	{"docker", func(ctx context.Context) (func(*HardwareInfo), *nerr.E) {
+		docker, err := localsystem.DockerInfo(ctx)
+		return func(info *HardwareInfo) { info.Docker = &docker }, err
+	}},
+	{"procs", func(ctx context.Context) (func(*HardwareInfo), *nerr.E) {
+		procs, err := localsystem.ProcsInfo()
+		return func(info *HardwareInfo) { info.Procs = &procs }, err
+	}},
+	{"pi", func(ctx context.Context) (func(*HardwareInfo), *nerr.E) {
+		pi, err := localsystem.PiHealthInfo(ctx)
+		return func(info *HardwareInfo) { info.Pi = &pi }, err
+	}},
+}
+
+var (
+	// running are the collectors that haven't returned yet, so that one that hangs isn't started again until it does
+	running   = make(map[string]bool)
+	runningMu sync.Mutex
+)
+
+// PiInfo runs each collector in parallel, and returns whatever could be collected within collectorTimeout.
+// the error from each section that failed is put in info.Errors; an error is only returned if every section failed.
+func PiInfo(ctx context.Context) (HardwareInfo, *nerr.E) {
 	log.L.Infof("Getting pi hardware info")
-	var info HardwareInfo
-	var err *nerr.E
+	info := HardwareInfo{
+		Version: SchemaVersion,
+		Errors:  make(map[string]string),
+	}
+
+	results := make(chan collected, len(collectors))
+
+	for _, c := range collectors {
+		runningMu.Lock()
+		if running[c.name] {
+			runningMu.Unlock()
 
-	info.CPU, err = localsystem.CPUInfo()
-	if err != nil {
-		return info, err.Addf("failed to get hardware info")
+			results <- collected{name: c.name, err: fmt.Errorf("the previous collection is still running")}
+			continue
+		}
+
+		running[c.name] = true
+		runningMu.Unlock()
+
+		go func(c collector) {
+			ctx, cancel := context.WithTimeout(ctx, collectorTimeout)
+			defer cancel()
+
+			done := make(chan collected, 1)
+
+			go func() {
+				defer func() {
+					runningMu.Lock()
+					delete(running, c.name)
+					runningMu.Unlock()
+				}()
+
+				apply, err := c.collect(ctx)
+				if err != nil {
+					done <- collected{name: c.name, err: err}
+					return
+				}
+
+				done <- collected{name: c.name, apply: apply}
+			}()
+
+			select {
+			case res := <-done:
+				results <- res
+			case <-ctx.Done():
+				results <- collected{name: c.name, err: fmt.Errorf("gave up after %v: %s", collectorTimeout, ctx.Err())}
+			}
+		}(c)
 	}
 
-	info.Memory, err = localsystem.MemoryInfo()
-	if err != nil {
-		return info, err.Addf("failed to get hardware info")
+	for range collectors {
+		res := <-results
+		if res.err != nil {
+			log.L.Warnf("unable to get %s info: %s", res.name, res.err.Error())
+			info.Errors[res.name] = res.err.Error()
+			continue
+		}
+
+		res.apply(&info)
 	}
 
-	info.Host, err = localsystem.HostInfo()
-	if err != nil {
-		return info, err.Addf("failed to get hardware info")
+	if len(info.Errors) == len(collectors) {
+		return info, nerr.Create("failed to get hardware info: every collector failed", "error")
 	}
 
-	info.Disk, err = localsystem.DiskInfo()
-	if err != nil {
-		return info, err.Addf("failed to get hardware info")
+	if len(info.Errors) == 0 {
+		info.Errors = nil
 	}
 
-	info.Network, err = localsystem.NetworkInfo()
-	if err != nil {
-		return info, err.Addf("failed to get hardware info")
+	return info, nil
+}
+
+// Values flattens the numeric metrics in info into a map of metric name to value.
+// the names match the keys of the events sent by the hardware-info action.
+func (info HardwareInfo) Values() map[string]float64 {
+	values := make(map[string]float64)
+
+	for _, section := range info.SectionValues() {
+		for name, value := range section {
+			values[name] = value
+		}
 	}
 
-	info.Docker, err = localsystem.DockerInfo()
-	if err != nil {
-		return info, err.Addf("failed to get hardware info")
+	return values
+}
+
+// SectionValues is Values, grouped by the section of info (ie, cpu or disk) each metric comes from
+func (info HardwareInfo) SectionValues() map[string]map[string]float64 {
+	sections := make(map[string]map[string]float64)
+
+	add := func(section, name string, value float64) {
+		if sections[section] == nil {
+			sections[section] = make(map[string]float64)
+		}
+
+		sections[section][name] = value
 	}
 
-	info.Procs, err = localsystem.ProcsInfo()
-	if err != nil {
-		return info, err.Addf("failed to get hardware info")
+	if info.CPU != nil {
+		if avg, ok := info.CPU.Usage["avg"]; ok {
+			add("cpu", "cpu-usage-percent", avg)
+		}
+
+		add("cpu", "cpu-load-average-1-min", info.CPU.LoadAvg1Min)
+		add("cpu", "cpu-load-average-5-min", info.CPU.LoadAvg5Min)
+		add("cpu", "cpu-load-average-15-min", info.CPU.LoadAvg15Min)
 	}
 
-	return info, nil
+	if info.Memory != nil {
+		if info.Memory.Virtual != nil {
+			add("memory", "v-mem-used-percent", info.Memory.Virtual.UsedPercent)
+		}
+
+		if info.Memory.Swap != nil {
+			add("memory", "s-mem-used-percent", info.Memory.Swap.UsedPercent)
+		}
+	}
+
+	if info.Host != nil {
+		for chip, temp := range info.Host.Temperature {
+			add("host", fmt.Sprintf("%s-temp", chip), temp)
+		}
+	}
+
+	if info.Disk != nil {
+		if info.Disk.Usage != nil {
+			add("disk", "disk-used-percent", info.Disk.Usage.UsedPercent)
+		}
+
+		for name, stats := range info.Disk.IOCounters {
+			add("disk", fmt.Sprintf("writes-to-%s", name), float64(stats.WriteCount))
+		}
+
+		for name, tp := range info.Disk.Throughput {
+			add("disk", fmt.Sprintf("%s-read-bytes-per-sec", name), tp.ReadBytesPerSec)
+			add("disk", fmt.Sprintf("%s-write-bytes-per-sec", name), tp.WriteBytesPerSec)
+		}
+
+		for _, fs := range info.Disk.Filesystems {
+			name := MountName(fs.MountPoint)
+
+			add("disk", fmt.Sprintf("%s-read-only", name), boolToFloat(fs.ReadOnly))
+
+			if fs.Usage != nil {
+				add("disk", fmt.Sprintf("%s-used-percent", name), fs.Usage.UsedPercent)
+				add("disk", fmt.Sprintf("%s-inodes-used-percent", name), fs.Usage.InodesUsedPercent)
+			}
+
+			if fs.ErrorCount != nil {
+				add("disk", fmt.Sprintf("%s-fs-errors", name), float64(*fs.ErrorCount))
+			}
+		}
+	}
+
+	if info.Procs != nil {
+		add("procs", "avg-procs-u-sleep", info.Procs.AvgInUSleep)
+		add("procs", "procs-u-sleep", float64(len(info.Procs.InUSleep)))
+
+		for window, avg := range info.Procs.AvgsInUSleep {
+			add("procs", fmt.Sprintf("avg-procs-u-sleep-%s", window), avg)
+		}
+	}
+
+	if info.Docker != nil {
+		add("docker", "docker-containers", float64(info.Docker.RunningContainers))
+
+		for _, c := range info.Docker.Containers {
+			add("docker", fmt.Sprintf("container-%s-running", c.Name), boolToFloat(c.State == "running"))
+			add("docker", fmt.Sprintf("container-%s-restarts", c.Name), float64(c.RestartCount))
+
+			if c.State == "running" {
+				add("docker", fmt.Sprintf("container-%s-cpu-percent", c.Name), c.CPUPercent)
+				add("docker", fmt.Sprintf("container-%s-memory-mb", c.Name), c.MemoryMB)
+			}
+		}
+	}
+
+	if info.Pi != nil {
+		if info.Pi.Throttled != nil {
+			add("pi", "under-voltage", boolToFloat(info.Pi.Throttled.UnderVoltage))
+			add("pi", "cpu-throttled", boolToFloat(info.Pi.Throttled.Throttled))
+		}
+
+		for clock, mhz := range info.Pi.ClocksMHz {
+			add("pi", fmt.Sprintf("%s-clock-mhz", clock), float64(mhz))
+		}
+
+		if info.Pi.CoreVolts != nil {
+			add("pi", "core-volts", *info.Pi.CoreVolts)
+		}
+
+		for _, storage := range info.Pi.Storage {
+			if storage.LifeTimeUsed != nil {
+				add("pi", fmt.Sprintf("%s-life-time-used-percent", storage.Device), float64(*storage.LifeTimeUsed))
+			}
+		}
+	}
+
+	return sections
+}
+
+// MountName turns a mount point into a name that can be used in a metric or event key (ie, /boot -> disk-boot)
+func MountName(mountPoint string) string {
+	name := strings.Trim(mountPoint, "/")
+	if len(name) == 0 {
+		name = "root"
+	}
+
+	return "disk-" + strings.Replace(name, "/", "-", -1)
+}
+
+func boolToFloat(b bool) float64 {
+	if b {
+		return 1
+	}
+
+	return 0
 }
@@ -0,0 +1,168 @@
+package health
+
+import (
+	"encoding/json"
+	"math"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/byuoitav/device-monitoring/metrics"
+)
+
+const (
+	// the number of results kept for each service
+	historySize = 288
+
+	// the longest a response body kept in the history can be
+	maxStoredBody = 4 * 1024
+)
+
+// ServiceSummary is a summary of the recent checks of a service
+type ServiceSummary struct {
+	Name          string                 `json:"name"`
+	Checks        int                    `json:"checks"`
+	Healthy       bool                   `json:"healthy"`
+	UptimePercent float64                `json:"uptime-percent"`
+	LastCheck     time.Time              `json:"last-check"`
+	LastHealthy   *time.Time             `json:"last-healthy,omitempty"`
+	Failures      []ServiceCheckResponse `json:"failures,omitempty"`
+}
+
+// serviceHistory is a fixed size ring of the most recent results for a service
+type serviceHistory struct {
+	results []ServiceCheckResponse
+	next    int
+	full    bool
+}
+
+var (
+	history   = make(map[string]*serviceHistory)
+	historyMu sync.RWMutex
+)
+
+// Record adds the results of a configured service check to the history
+func Record(resps []ServiceCheckResponse) {
+	for i := range resps {
+		record(resps[i])
+	}
+}
+
+func record(resp ServiceCheckResponse) {
+	resp.Body = storedBody(resp.Body)
+
+	historyMu.Lock()
+	defer historyMu.Unlock()
+
+	h, ok := history[resp.Name]
+	if !ok {
+		h = &serviceHistory{
+			results: make([]ServiceCheckResponse, historySize),
+		}
+
+		history[resp.Name] = h
+	}
+
+	h.results[h.next] = resp
+	h.next = (h.next + 1) % len(h.results)
+	if h.next == 0 {
+		h.full = true
+	}
+
+	metrics.ServiceCheck(resp.Name, resp.Healthy, h.uptime(), resp.responseTime)
+}
+
+// storedBody returns body, truncated to maxStoredBody once it's encoded
+func storedBody(body interface{}) interface{} {
+	if body == nil {
+		return nil
+	}
+
+	b, err := json.Marshal(body)
+	if err != nil || len(b) <= maxStoredBody {
+		return body
+	}
+
+	if s, ok := body.(string); ok && len(s) > maxStoredBody {
+		return s[:maxStoredBody] + "..."
+	}
+
+	return string(b[:maxStoredBody]) + "..."
+}
+
+// ordered returns the results in the order they were recorded
+func (h *serviceHistory) ordered() []ServiceCheckResponse {
+	if !h.full {
+		return h.results[:h.next]
+	}
+
+	return append(append([]ServiceCheckResponse{}, h.results[h.next:]...), h.results[:h.next]...)
+}
+
+func (h *serviceHistory) uptime() float64 {
+	results := h.ordered()
+	if len(results) == 0 {
+		return 0
+	}
+
+	healthy := 0
+	for i := range results {
+		if results[i].Healthy {
+			healthy++
+		}
+	}
+
+	return float64(healthy) / float64(len(results))
+}
+
+// ServiceHistory returns a summary of each service that has been checked, including the last n failures of each
+func ServiceHistory(n int) []ServiceSummary {
+	historyMu.RLock()
+	defer historyMu.RUnlock()
+
+	summaries := []ServiceSummary{}
+
+	for name, h := range history {
+		results := h.ordered()
+		if len(results) == 0 {
+			continue
+		}
+
+		last := results[len(results)-1]
+		summary := ServiceSummary{
+			Name:          name,
+			Checks:        len(results),
+			Healthy:       last.Healthy,
+			UptimePercent: round(h.uptime()*100, .01),
+			LastCheck:     last.Timestamp,
+		}
+
+		// walk backwards to find the most recent failures
+		for i := len(results) - 1; i >= 0; i-- {
+			if results[i].Healthy {
+				if summary.LastHealthy == nil {
+					t := results[i].Timestamp
+					summary.LastHealthy = &t
+				}
+
+				continue
+			}
+
+			if len(summary.Failures) < n {
+				summary.Failures = append(summary.Failures, results[i])
+			}
+		}
+
+		summaries = append(summaries, summary)
+	}
+
+	sort.Slice(summaries, func(i, j int) bool {
+		return summaries[i].Name < summaries[j].Name
+	})
+
+	return summaries
+}
+
+func round(x, unit float64) float64 {
+	return math.Round(x/unit) * unit
+}
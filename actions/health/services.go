@@ -5,29 +5,78 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"net/http"
+	"regexp"
+	"strings"
 	"sync"
+	"time"
+)
+
+const (
+	// ResponseTypeAuto parses the body as json if possible, otherwise it is kept as a string
+	ResponseTypeAuto = ""
+
+	// ResponseTypeJSON requires the body to be valid json
+	ResponseTypeJSON = "json"
+
+	// ResponseTypeText keeps the body as a string
+	ResponseTypeText = "text"
+
+	// ResponseTypeIgnore doesn't keep the body at all
+	ResponseTypeIgnore = "ignore"
+
+	defaultServiceTimeout = 10 * time.Second
+
+	// the most of a response body that's read
+	maxResponseBody = 1024 * 1024
 )
 
 // ServiceCheckConfig .
 type ServiceCheckConfig struct {
-	Name   string      `json:"name"`
-	URL    string      `json:"url"`
-	Method string      `json:"method"`
-	Body   interface{} `json:"body,omitempty"`
+	Name    string            `json:"name"`
+	URL     string            `json:"url"`
+	Method  string            `json:"method"`
+	Headers map[string]string `json:"headers,omitempty"`
+	Body    interface{}       `json:"body,omitempty"`
+
+	// Timeout is a duration string (ie, "5s"). defaults to 10s
+	Timeout string `json:"timeout,omitempty"`
+
+	// ResponseType is how the response body should be handled (json, text, or ignore).
+	// if it isn't set, the body is parsed as json if possible, and kept as a string if it isn't.
+	ResponseType string `json:"response-type,omitempty"`
+
+	// ExpectedStatus is the list of status codes that are considered healthy. defaults to any 2xx
+	ExpectedStatus []int `json:"expected-status,omitempty"`
+
+	// BodyContains is a string the response body must contain
+	BodyContains string `json:"body-contains,omitempty"`
+
+	// BodyMatches is a regular expression the response body must match
+	BodyMatches string `json:"body-matches,omitempty"`
+
+	// JSONFields maps a dot separated path in the response body (ie, "status.ok") to the value it should have
+	JSONFields map[string]interface{} `json:"json-fields,omitempty"`
 }
 
 // ServiceCheckResponse .
 type ServiceCheckResponse struct {
 	ServiceCheckConfig `json:"request"`
 
-	StatusCode int         `json:"status-code,omitempty"`
-	Error      string      `json:"error,omitempty"`
-	Body       interface{} `json:"response-body,omitempty"`
+	Timestamp    time.Time   `json:"timestamp"`
+	Healthy      bool        `json:"healthy"`
+	ResponseTime string      `json:"response-time,omitempty"`
+	StatusCode   int         `json:"status-code,omitempty"`
+	Error        string      `json:"error,omitempty"`
+	Failures     []string    `json:"failures,omitempty"`
+	Body         interface{} `json:"response-body,omitempty"`
+
+	responseTime time.Duration
 }
 
-// CheckServices .
+// CheckServices checks each service. the results aren't recorded in the history; see Record
 func CheckServices(ctx context.Context, checks []ServiceCheckConfig) []ServiceCheckResponse {
 	wg := sync.WaitGroup{}
 	resps := []ServiceCheckResponse{}
@@ -57,8 +106,23 @@ func CheckServices(ctx context.Context, checks []ServiceCheckConfig) []ServiceCh
 func checkService(ctx context.Context, check ServiceCheckConfig) ServiceCheckResponse {
 	sresp := ServiceCheckResponse{
 		ServiceCheckConfig: check,
+		Timestamp:          time.Now(),
 	}
 
+	timeout := defaultServiceTimeout
+	if len(check.Timeout) > 0 {
+		d, err := time.ParseDuration(check.Timeout)
+		if err != nil {
+			sresp.Error = fmt.Sprintf("invalid timeout '%s': %s", check.Timeout, err)
+			return sresp
+		}
+
+		timeout = d
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
 	body := bytes.NewReader(nil)
 	if check.Body != nil {
 		b, err := json.Marshal(check.Body)
@@ -76,27 +140,144 @@ func checkService(ctx context.Context, check ServiceCheckConfig) ServiceCheckRes
 		return sresp
 	}
 
+	for k, v := range check.Headers {
+		req.Header.Set(k, v)
+	}
+
+	if check.Body != nil && len(req.Header.Get("Content-Type")) == 0 {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
 	req = req.WithContext(ctx)
+	start := time.Now()
+
 	resp, err := http.DefaultClient.Do(req)
 	if err != nil {
-		sresp.Error = fmt.Sprintf("unable to make reuqest: %s", err)
+		sresp.Error = fmt.Sprintf("unable to make request: %s", err)
 		return sresp
 	}
 	defer resp.Body.Close()
 
 	sresp.StatusCode = resp.StatusCode
 
-	b, err := ioutil.ReadAll(resp.Body)
-	if err != nil {
+	b, err := ioutil.ReadAll(io.LimitReader(resp.Body, maxResponseBody+1))
+	sresp.responseTime = time.Since(start)
+	sresp.ResponseTime = sresp.responseTime.String()
+
+	switch {
+	case err != nil:
 		sresp.Error = fmt.Sprintf("unable to read response body: %s", err)
 		return sresp
+	case len(b) > maxResponseBody:
+		sresp.Error = fmt.Sprintf("response body is larger than %d bytes", maxResponseBody)
+		return sresp
 	}
 
-	err = json.Unmarshal(b, &sresp.Body)
-	if err != nil {
-		sresp.Error = fmt.Sprintf("unable to parse response body: %s", err)
-		return sresp
+	var parsed interface{}
+	isJSON := json.Unmarshal(b, &parsed) == nil
+
+	switch check.ResponseType {
+	case ResponseTypeJSON:
+		if !isJSON {
+			sresp.Error = fmt.Sprintf("unable to parse response body as json: %s", b)
+			return sresp
+		}
+
+		sresp.Body = parsed
+	case ResponseTypeText:
+		sresp.Body = string(b)
+	case ResponseTypeIgnore:
+	default:
+		if isJSON {
+			sresp.Body = parsed
+		} else if len(b) > 0 {
+			sresp.Body = string(b)
+		}
 	}
 
+	sresp.Failures = check.validate(resp.StatusCode, b, parsed, isJSON)
+	sresp.Healthy = len(sresp.Failures) == 0
+
 	return sresp
 }
+
+// validate returns a list of the expectations that the response didn't meet
+func (check ServiceCheckConfig) validate(status int, body []byte, parsed interface{}, isJSON bool) []string {
+	var failures []string
+
+	if len(check.ExpectedStatus) > 0 {
+		found := false
+		for _, code := range check.ExpectedStatus {
+			if code == status {
+				found = true
+				break
+			}
+		}
+
+		if !found {
+			failures = append(failures, fmt.Sprintf("expected status in %v, got %v", check.ExpectedStatus, status))
+		}
+	} else if status/100 != 2 {
+		failures = append(failures, fmt.Sprintf("expected a 2xx status, got %v", status))
+	}
+
+	if len(check.BodyContains) > 0 && !strings.Contains(string(body), check.BodyContains) {
+		failures = append(failures, fmt.Sprintf("response body does not contain '%s'", check.BodyContains))
+	}
+
+	if len(check.BodyMatches) > 0 {
+		reg, err := regexp.Compile(check.BodyMatches)
+		switch {
+		case err != nil:
+			failures = append(failures, fmt.Sprintf("invalid body-matches regex '%s': %s", check.BodyMatches, err))
+		case !reg.Match(body):
+			failures = append(failures, fmt.Sprintf("response body does not match '%s'", check.BodyMatches))
+		}
+	}
+
+	if len(check.JSONFields) > 0 && !isJSON {
+		return append(failures, "response body is not json, unable to check json-fields")
+	}
+
+	for path, expected := range check.JSONFields {
+		actual, ok := lookupJSONPath(parsed, path)
+		if !ok {
+			failures = append(failures, fmt.Sprintf("response body is missing '%s'", path))
+			continue
+		}
+
+		if fmt.Sprintf("%v", actual) != fmt.Sprintf("%v", expected) {
+			failures = append(failures, fmt.Sprintf("expected '%s' to be '%v', got '%v'", path, expected, actual))
+		}
+	}
+
+	return failures
+}
+
+// lookupJSONPath finds the value at a dot separated path in a parsed json body
+func lookupJSONPath(body interface{}, path string) (interface{}, bool) {
+	cur := body
+
+	for _, key := range strings.Split(path, ".") {
+		switch v := cur.(type) {
+		case map[string]interface{}:
+			next, ok := v[key]
+			if !ok {
+				return nil, false
+			}
+
+			cur = next
+		case []interface{}:
+			var idx int
+			if _, err := fmt.Sscanf(key, "%d", &idx); err != nil || idx < 0 || idx >= len(v) {
+				return nil, false
+			}
+
+			cur = v[idx]
+		default:
+			return nil, false
+		}
+	}
+
+	return cur, true
+}
@@ -0,0 +1,295 @@
+package logwatch
+
+import (
+	"context"
+	"regexp"
+	"sort"
+	"time"
+
+	"github.com/byuoitav/common/nerr"
+	"go.uber.org/zap"
+)
+
+const (
+	// Kernel is the kernel ring buffer
+	Kernel = "kernel"
+
+	// Journal is the systemd journal, not including kernel messages
+	Journal = "journal"
+
+	defaultWindow    = time.Minute
+	defaultMaxEvents = 10
+	maxLines         = 20
+)
+
+// DefaultSignatures are failures commonly seen on pi's
+var DefaultSignatures = []Signature{
+	{
+		Name:    "sd-card-io-error",
+		Pattern: `(mmc\d+: .*(error|timeout|timed out))|(blk_update_request: I/O error.*mmcblk)|(Buffer I/O error on dev(ice)? mmcblk)|(EXT4-fs error)`,
+		Sources: []string{Kernel},
+	},
+	{
+		Name:    "usb-reset",
+		Pattern: `usb \S+: (reset \S+ USB device|device descriptor read/\d+, error|device not accepting address)`,
+		Sources: []string{Kernel},
+	},
+	{
+		Name:    "hdmi-hotplug",
+		Pattern: `(?i)(hdmi.*(hotplug|hpd|connected|disconnected))|(vc4.*hotplug)`,
+		Sources: []string{Kernel},
+	},
+	{
+		Name:    "oom-kill",
+		Pattern: `(Out of memory: Kill(ed)? process)|(oom-kill:)|(invoked oom-killer)`,
+		Sources: []string{Kernel},
+	},
+	{
+		Name:    "under-voltage",
+		Pattern: `Under-voltage detected`,
+		Sources: []string{Kernel},
+	},
+}
+
+// Config is what to watch for
+type Config struct {
+	Signatures []Signature `json:"signatures,omitempty"`
+
+	// IncludeDefaults adds DefaultSignatures to Signatures
+	IncludeDefaults bool `json:"include-defaults,omitempty"`
+}
+
+// Signature is a pattern that indicates a failure
+type Signature struct {
+	Name    string `json:"name"`
+	Pattern string `json:"pattern"`
+
+	// Sources are the logs to check. defaults to both the kernel and the journal
+	Sources []string `json:"sources,omitempty"`
+
+	// Units only matches journal messages from these systemd units
+	Units []string `json:"units,omitempty"`
+
+	// Window is how long matches are grouped into a single event. defaults to 1m
+	Window string `json:"window,omitempty"`
+
+	// MaxEventsPerHour is the most events that will be sent for this signature in an hour. defaults to 10
+	MaxEventsPerHour int `json:"max-events-per-hour,omitempty"`
+
+	reg    *regexp.Regexp
+	window time.Duration
+}
+
+// Line is a line from a log
+type Line struct {
+	Source    string    `json:"source"`
+	Unit      string    `json:"unit,omitempty"`
+	Timestamp time.Time `json:"timestamp"`
+	Text      string    `json:"text"`
+}
+
+// Match is a group of lines that matched a signature
+type Match struct {
+	Signature string    `json:"signature"`
+	Count     int       `json:"count"`
+	First     time.Time `json:"first"`
+	Last      time.Time `json:"last"`
+	Lines     []Line    `json:"lines"`
+
+	// Suppressed is the number of matches that weren't sent because of the rate limit since the last event
+	Suppressed int `json:"suppressed,omitempty"`
+}
+
+// bucket is the state of a single signature
+type bucket struct {
+	sig *Signature
+
+	// pending is the matches that haven't been sent yet
+	pending *Match
+	seen    map[string]bool
+
+	lastSent   time.Time
+	sent       []time.Time
+	suppressed int
+}
+
+// Watch tails the kernel ring buffer and the journal until ctx is cancelled, calling send with each group of matching lines.
+// the first match of a signature is sent right away; matches after that are grouped until the signature's window has passed.
+func Watch(ctx context.Context, config Config, send func(Match), log *zap.SugaredLogger) *nerr.E {
+	sigs := config.Signatures
+	if config.IncludeDefaults || len(sigs) == 0 {
+		sigs = append(sigs, DefaultSignatures...)
+	}
+
+	buckets := make(map[string]*bucket)
+	sources := make(map[string]bool)
+
+	for i := range sigs {
+		sig := &sigs[i]
+		if err := sig.compile(); err != nil {
+			return err.Addf("unable to watch logs")
+		}
+
+		if _, ok := buckets[sig.Name]; ok {
+			return nerr.Createf("invalid", "unable to watch logs: signature %s is defined more than once", sig.Name)
+		}
+
+		buckets[sig.Name] = &bucket{sig: sig}
+
+		for _, source := range sig.Sources {
+			sources[source] = true
+		}
+	}
+
+	lines := make(chan Line, 256)
+	for source := range sources {
+		go tail(ctx, source, lines, log)
+	}
+
+	flush := time.NewTicker(time.Second)
+	defer flush.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			log.Infof("Stopping log watcher: %s", ctx.Err())
+			return nil
+		case line := <-lines:
+			for _, b := range buckets {
+				if b.sig.matches(line) {
+					b.add(line, send, log)
+				}
+			}
+		case now := <-flush.C:
+			for _, b := range buckets {
+				if b.pending != nil && now.Sub(b.lastSent) >= b.sig.window {
+					b.flush(now, send, log)
+				}
+			}
+		}
+	}
+}
+
+func (s *Signature) compile() *nerr.E {
+	if len(s.Name) == 0 {
+		return nerr.Create("signature is missing a name", "invalid")
+	}
+
+	reg, err := regexp.Compile(s.Pattern)
+	if err != nil {
+		return nerr.Translate(err).Addf("invalid pattern for signature %s", s.Name)
+	}
+
+	s.reg = reg
+
+	if len(s.Sources) == 0 {
+		s.Sources = []string{Kernel, Journal}
+	}
+
+	for _, source := range s.Sources {
+		if source != Kernel && source != Journal {
+			return nerr.Createf("invalid", "invalid source '%s' for signature %s", source, s.Name)
+		}
+	}
+
+	s.window = defaultWindow
+	if len(s.Window) > 0 {
+		d, err := time.ParseDuration(s.Window)
+		if err != nil || d <= 0 {
+			return nerr.Createf("invalid", "invalid window '%s' for signature %s", s.Window, s.Name)
+		}
+
+		s.window = d
+	}
+
+	if s.MaxEventsPerHour <= 0 {
+		s.MaxEventsPerHour = defaultMaxEvents
+	}
+
+	return nil
+}
+
+func (s *Signature) matches(line Line) bool {
+	found := false
+	for _, source := range s.Sources {
+		if source == line.Source {
+			found = true
+			break
+		}
+	}
+
+	if !found {
+		return false
+	}
+
+	if len(s.Units) > 0 {
+		found = false
+		for _, unit := range s.Units {
+			if unit == line.Unit {
+				found = true
+				break
+			}
+		}
+
+		if !found {
+			return false
+		}
+	}
+
+	return s.reg.MatchString(line.Text)
+}
+
+func (b *bucket) add(line Line, send func(Match), log *zap.SugaredLogger) {
+	if b.pending == nil {
+		b.pending = &Match{
+			Signature: b.sig.Name,
+			First:     line.Timestamp,
+		}
+
+		b.seen = make(map[string]bool)
+	}
+
+	b.pending.Count++
+	b.pending.Last = line.Timestamp
+
+	// don't attach the same line more than once
+	if !b.seen[line.Text] && len(b.pending.Lines) < maxLines {
+		b.seen[line.Text] = true
+		b.pending.Lines = append(b.pending.Lines, line)
+	}
+
+	// send the first match right away
+	if time.Since(b.lastSent) >= b.sig.window {
+		b.flush(time.Now(), send, log)
+	}
+}
+
+func (b *bucket) flush(now time.Time, send func(Match), log *zap.SugaredLogger) {
+	match := *b.pending
+	b.pending = nil
+	b.seen = nil
+
+	// forget about events sent over an hour ago
+	i := sort.Search(len(b.sent), func(i int) bool {
+		return now.Sub(b.sent[i]) < time.Hour
+	})
+
+	b.sent = b.sent[i:]
+
+	if len(b.sent) >= b.sig.MaxEventsPerHour {
+		if b.suppressed == 0 {
+			log.Warnf("%s has matched more than %d times in the last hour; suppressing events", b.sig.Name, b.sig.MaxEventsPerHour)
+		}
+
+		b.suppressed += match.Count
+		b.lastSent = now
+		return
+	}
+
+	match.Suppressed = b.suppressed
+	b.suppressed = 0
+	b.lastSent = now
+	b.sent = append(b.sent, now)
+
+	send(match)
+}
@@ -0,0 +1,212 @@
+package logwatch
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"os/exec"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+const (
+	minRestartDelay = 5 * time.Second
+	maxRestartDelay = 5 * time.Minute
+)
+
+// dmesgTimestamp is the time since boot at the start of a dmesg line (ie, [ 1234.567890] )
+var dmesgTimestamp = regexp.MustCompile(`^\[\s*(\d+\.\d+)\]\s?`)
+
+// tail follows source until ctx is cancelled, restarting it if it exits
+func tail(ctx context.Context, source string, lines chan<- Line, log *zap.SugaredLogger) {
+	delay := minRestartDelay
+
+	for {
+		start := time.Now()
+
+		var err error
+		switch source {
+		case Kernel:
+			err = tailKernel(ctx, lines)
+		case Journal:
+			err = tailJournal(ctx, lines)
+		}
+
+		if ctx.Err() != nil {
+			return
+		}
+
+		// reset the backoff if it ran for a while
+		if time.Since(start) > maxRestartDelay {
+			delay = minRestartDelay
+		}
+
+		log.Warnf("stopped tailing %s (%v); restarting in %v", source, err, delay)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(delay):
+		}
+
+		delay *= 2
+		if delay > maxRestartDelay {
+			delay = maxRestartDelay
+		}
+	}
+}
+
+// tailKernel follows the kernel ring buffer, skipping messages from before it started
+func tailKernel(ctx context.Context, lines chan<- Line) error {
+	uptime, err := uptime()
+	if err != nil {
+		return err
+	}
+
+	boot := time.Now().Add(-uptime)
+
+	return follow(ctx, exec.CommandContext(ctx, "dmesg", "--follow"), func(text string) {
+		line := Line{
+			Source:    Kernel,
+			Timestamp: time.Now(),
+			Text:      text,
+		}
+
+		if m := dmesgTimestamp.FindStringSubmatch(text); len(m) == 2 {
+			secs, err := strconv.ParseFloat(m[1], 64)
+			if err == nil {
+				since := time.Duration(secs * float64(time.Second))
+
+				// dmesg prints the whole buffer first
+				if since < uptime {
+					return
+				}
+
+				line.Timestamp = boot.Add(since)
+			}
+
+			line.Text = text[len(m[0]):]
+		}
+
+		send(ctx, lines, line)
+	})
+}
+
+type journalEntry struct {
+	Message    json.RawMessage `json:"MESSAGE"`
+	Unit       string          `json:"_SYSTEMD_UNIT"`
+	Identifier string          `json:"SYSLOG_IDENTIFIER"`
+	Transport  string          `json:"_TRANSPORT"`
+	Timestamp  string          `json:"__REALTIME_TIMESTAMP"`
+}
+
+// tailJournal follows new messages in the journal, skipping kernel messages (those come from tailKernel)
+func tailJournal(ctx context.Context, lines chan<- Line) error {
+	cmd := exec.CommandContext(ctx, "journalctl", "--follow", "--lines=0", "--output=json", "--no-pager")
+
+	return follow(ctx, cmd, func(text string) {
+		var entry journalEntry
+		if err := json.Unmarshal([]byte(text), &entry); err != nil {
+			return
+		}
+
+		if entry.Transport == "kernel" {
+			return
+		}
+
+		line := Line{
+			Source:    Journal,
+			Unit:      entry.Unit,
+			Timestamp: time.Now(),
+			Text:      journalMessage(entry.Message),
+		}
+
+		if len(line.Unit) == 0 {
+			line.Unit = entry.Identifier
+		}
+
+		if usec, err := strconv.ParseInt(entry.Timestamp, 10, 64); err == nil {
+			line.Timestamp = time.Unix(0, usec*int64(time.Microsecond))
+		}
+
+		send(ctx, lines, line)
+	})
+}
+
+// journalMessage decodes a journal message, which is an array of bytes if it isn't valid utf-8
+func journalMessage(raw json.RawMessage) string {
+	var s string
+	if err := json.Unmarshal(raw, &s); err == nil {
+		return s
+	}
+
+	var b []byte
+	var ints []int
+	if err := json.Unmarshal(raw, &ints); err == nil {
+		for _, i := range ints {
+			b = append(b, byte(i))
+		}
+	}
+
+	return string(b)
+}
+
+// follow runs cmd, calling handle with each line it prints until it exits
+func follow(ctx context.Context, cmd *exec.Cmd, handle func(string)) error {
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+
+	scanner := bufio.NewScanner(stdout)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+
+	for scanner.Scan() {
+		handle(strings.TrimRight(scanner.Text(), "\r"))
+	}
+
+	// if the scanner failed (ie, a line was too long), the process is killed so that it's restarted
+	if err := scanner.Err(); err != nil {
+		cmd.Process.Kill()
+		cmd.Wait()
+		return err
+	}
+
+	return cmd.Wait()
+}
+
+func send(ctx context.Context, lines chan<- Line, line Line) {
+	select {
+	case lines <- line:
+	case <-ctx.Done():
+	}
+}
+
+func uptime() (time.Duration, error) {
+	b, err := ioutil.ReadFile("/proc/uptime")
+	if err != nil {
+		return 0, err
+	}
+
+	fields := strings.Fields(string(b))
+	if len(fields) == 0 {
+		return 0, io.ErrUnexpectedEOF
+	}
+
+	secs, err := strconv.ParseFloat(fields[0], 64)
+	if err != nil {
+		return 0, err
+	}
+
+	return time.Duration(secs * float64(time.Second)), nil
+}
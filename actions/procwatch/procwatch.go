@@ -0,0 +1,385 @@
+package procwatch
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/byuoitav/common/nerr"
+	"github.com/byuoitav/device-monitoring/localsystem"
+	"github.com/shirou/gopsutil/process"
+)
+
+const (
+	// Died means a watched process stopped running
+	Died = "process-died"
+
+	// Started means a watched process that wasn't running started
+	Started = "process-started"
+
+	// Restarted means a watched process was replaced by a new one between checks
+	Restarted = "process-restarted"
+
+	// LimitExceeded means a watched process crossed one of its resource limits
+	LimitExceeded = "process-limit-exceeded"
+
+	// LimitCleared means a watched process went back under one of its resource limits
+	LimitCleared = "process-limit-cleared"
+)
+
+var cgroupRoots = []string{"/sys/fs/cgroup/systemd", "/sys/fs/cgroup/unified", "/sys/fs/cgroup"}
+
+// Config is a process or systemd unit to watch
+type Config struct {
+	Name string `json:"name"`
+
+	// Process matches processes with this exact name
+	Process string `json:"process,omitempty"`
+
+	// Cmdline matches processes whose full command line matches this regular expression
+	Cmdline string `json:"cmdline,omitempty"`
+
+	// Unit matches the processes in this systemd unit
+	Unit string `json:"unit,omitempty"`
+
+	// Self matches this process
+	Self bool `json:"self,omitempty"`
+
+	Limits Limits `json:"limits,omitempty"`
+}
+
+// Limits are resource limits for a watched process. a zero value is no limit
+type Limits struct {
+	CPUPercent float64 `json:"cpu-percent,omitempty"`
+	RSSMB      float64 `json:"rss-mb,omitempty"`
+	OpenFiles  int32   `json:"open-files,omitempty"`
+}
+
+// Status is the state of a watched process. when several processes match, their usage is summed
+type Status struct {
+	Name        string    `json:"name"`
+	Unit        string    `json:"unit,omitempty"`
+	Running     bool      `json:"running"`
+	ActiveState string    `json:"active-state,omitempty"`
+	PIDs        []int32   `json:"pids,omitempty"`
+	Restarts    int       `json:"restarts"`
+	StartedAt   time.Time `json:"started-at,omitempty"`
+	Uptime      string    `json:"uptime,omitempty"`
+	CPUPercent  float64   `json:"cpu-percent"`
+	RSSMB       float64   `json:"rss-mb"`
+	OpenFiles   int32     `json:"open-files"`
+
+	ExceededLimits []string `json:"exceeded-limits,omitempty"`
+	Errors         []string `json:"errors,omitempty"`
+}
+
+// Change is something that happened to a watched process since the last check
+type Change struct {
+	Name   string `json:"name"`
+	Type   string `json:"type"`
+	Detail string `json:"detail,omitempty"`
+	Status Status `json:"status"`
+}
+
+type watched struct {
+	running  bool
+	mainPID  int32
+	restarts int
+	exceeded map[string]bool
+}
+
+// Watcher remembers the state of each watched process between checks
+type Watcher struct {
+	watched map[string]*watched
+
+	// processes are kept between checks so that cpu usage can be measured over the interval
+	procs map[int32]*process.Process
+	mu    sync.Mutex
+}
+
+// NewWatcher .
+func NewWatcher() *Watcher {
+	return &Watcher{
+		watched: make(map[string]*watched),
+		procs:   make(map[int32]*process.Process),
+	}
+}
+
+// Check gets the status of each config, and returns what changed since the last check
+func (w *Watcher) Check(ctx context.Context, configs []Config) ([]Status, []Change, *nerr.E) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	pids, err := process.Pids()
+	if err != nil {
+		return nil, nil, nerr.Translate(err).Addf("failed to check watched processes")
+	}
+
+	// forget processes that have exited
+	alive := make(map[int32]bool)
+	for _, pid := range pids {
+		alive[pid] = true
+	}
+
+	for pid := range w.procs {
+		if !alive[pid] {
+			delete(w.procs, pid)
+		}
+	}
+
+	var statuses []Status
+	var changes []Change
+
+	for _, config := range configs {
+		if len(config.Name) == 0 {
+			return statuses, changes, nerr.Create("watched process is missing a name", "invalid")
+		}
+
+		status, matched, err := w.status(ctx, config, pids)
+		if err != nil {
+			return statuses, changes, err.Addf("failed to check %s", config.Name)
+		}
+
+		changes = append(changes, w.compare(config, &status, matched)...)
+		statuses = append(statuses, status)
+	}
+
+	return statuses, changes, nil
+}
+
+func (w *Watcher) status(ctx context.Context, config Config, pids []int32) (Status, []*process.Process, *nerr.E) {
+	status := Status{
+		Name: config.Name,
+		Unit: config.Unit,
+	}
+
+	var matched []*process.Process
+
+	switch {
+	case config.Self:
+		matched = append(matched, w.proc(int32(os.Getpid())))
+	case len(config.Unit) > 0:
+		unit, err := localsystem.UnitStatus(ctx, config.Unit)
+		if err != nil {
+			status.Errors = append(status.Errors, err.Error())
+		}
+
+		status.ActiveState = unit.ActiveState
+		status.Restarts = unit.Restarts
+		status.StartedAt = unit.Since
+
+		for _, pid := range unitPids(unit) {
+			matched = append(matched, w.proc(pid))
+		}
+	case len(config.Process) > 0 || len(config.Cmdline) > 0:
+		var reg *regexp.Regexp
+		if len(config.Cmdline) > 0 {
+			var err error
+
+			reg, err = regexp.Compile(config.Cmdline)
+			if err != nil {
+				return status, nil, nerr.Translate(err).Addf("invalid cmdline regex '%s'", config.Cmdline)
+			}
+		}
+
+		for _, pid := range pids {
+			p := w.proc(pid)
+
+			if len(config.Process) > 0 {
+				if name, err := p.Name(); err != nil || name != config.Process {
+					continue
+				}
+			}
+
+			if reg != nil {
+				if cmdline, err := p.Cmdline(); err != nil || !reg.MatchString(cmdline) {
+					continue
+				}
+			}
+
+			matched = append(matched, p)
+		}
+	default:
+		return status, nil, nerr.Create("one of process, cmdline, unit, or self must be set", "invalid")
+	}
+
+	// oldest process first, so the first process is the 'main' one
+	createTimes := make(map[int32]int64)
+	for _, p := range matched {
+		createTimes[p.Pid], _ = p.CreateTime()
+	}
+
+	sort.Slice(matched, func(i, j int) bool {
+		return createTimes[matched[i].Pid] < createTimes[matched[j].Pid]
+	})
+
+	for _, p := range matched {
+		status.PIDs = append(status.PIDs, p.Pid)
+
+		if percent, err := p.Percent(0); err == nil {
+			status.CPUPercent += percent
+		}
+
+		if mem, err := p.MemoryInfo(); err == nil {
+			status.RSSMB += float64(mem.RSS) / 1024 / 1024
+		}
+
+		if fds, err := p.NumFDs(); err == nil {
+			status.OpenFiles += fds
+		}
+	}
+
+	status.Running = len(matched) > 0
+	if len(status.ActiveState) > 0 {
+		status.Running = status.Running && status.ActiveState == "active"
+	}
+
+	if status.Running && status.StartedAt.IsZero() {
+		status.StartedAt = time.Unix(0, createTimes[matched[0].Pid]*int64(time.Millisecond))
+	}
+
+	if status.Running && !status.StartedAt.IsZero() {
+		status.Uptime = time.Since(status.StartedAt).Truncate(time.Second).String()
+	}
+
+	status.CPUPercent = round(status.CPUPercent)
+	status.RSSMB = round(status.RSSMB)
+
+	return status, matched, nil
+}
+
+// compare updates the state of the watched process and returns what changed since the last check
+func (w *Watcher) compare(config Config, status *Status, matched []*process.Process) []Change {
+	prev, ok := w.watched[config.Name]
+	if !ok {
+		prev = &watched{
+			running:  status.Running,
+			exceeded: make(map[string]bool),
+		}
+
+		if len(matched) > 0 {
+			prev.mainPID = matched[0].Pid
+		}
+
+		w.watched[config.Name] = prev
+	}
+
+	var changes []Change
+	change := func(typ, detail string) {
+		changes = append(changes, Change{
+			Name:   config.Name,
+			Type:   typ,
+			Detail: detail,
+		})
+	}
+
+	var mainPID int32
+	if len(matched) > 0 {
+		mainPID = matched[0].Pid
+	}
+
+	switch {
+	case prev.running && !status.Running:
+		change(Died, fmt.Sprintf("%s (pid %v) is no longer running", config.Name, prev.mainPID))
+	case !prev.running && status.Running:
+		prev.restarts++
+		change(Started, fmt.Sprintf("%s started (pid %v)", config.Name, mainPID))
+	case prev.running && status.Running && mainPID != prev.mainPID:
+		prev.restarts++
+		change(Restarted, fmt.Sprintf("%s restarted (pid %v -> %v)", config.Name, prev.mainPID, mainPID))
+	}
+
+	prev.running = status.Running
+	prev.mainPID = mainPID
+
+	// systemd keeps track of restarts itself
+	if len(config.Unit) == 0 {
+		status.Restarts = prev.restarts
+	}
+
+	// check the limits
+	limits := map[string]bool{
+		"cpu-percent": config.Limits.CPUPercent > 0 && status.CPUPercent > config.Limits.CPUPercent,
+		"rss-mb":      config.Limits.RSSMB > 0 && status.RSSMB > config.Limits.RSSMB,
+		"open-files":  config.Limits.OpenFiles > 0 && status.OpenFiles > config.Limits.OpenFiles,
+	}
+
+	values := map[string]interface{}{
+		"cpu-percent": status.CPUPercent,
+		"rss-mb":      status.RSSMB,
+		"open-files":  status.OpenFiles,
+	}
+
+	for _, limit := range []string{"cpu-percent", "rss-mb", "open-files"} {
+		exceeded := limits[limit]
+		if exceeded {
+			status.ExceededLimits = append(status.ExceededLimits, limit)
+		}
+
+		switch {
+		case exceeded && !prev.exceeded[limit]:
+			change(LimitExceeded, fmt.Sprintf("%s %s is %v", config.Name, limit, values[limit]))
+		case !exceeded && prev.exceeded[limit]:
+			change(LimitCleared, fmt.Sprintf("%s %s is %v", config.Name, limit, values[limit]))
+		}
+
+		prev.exceeded[limit] = exceeded
+	}
+
+	for i := range changes {
+		changes[i].Status = *status
+	}
+
+	return changes
+}
+
+func (w *Watcher) proc(pid int32) *process.Process {
+	if p, ok := w.procs[pid]; ok {
+		return p
+	}
+
+	p := &process.Process{Pid: pid}
+	w.procs[pid] = p
+	return p
+}
+
+// unitPids returns every process in the unit's cgroup, or its main process if the cgroup can't be read
+func unitPids(unit localsystem.Unit) []int32 {
+	var pids []int32
+
+	if len(unit.ControlGroup) > 0 {
+		for _, root := range cgroupRoots {
+			b, err := ioutil.ReadFile(filepath.Join(root, unit.ControlGroup, "cgroup.procs"))
+			if err != nil {
+				continue
+			}
+
+			for _, line := range strings.Fields(string(b)) {
+				if pid, err := strconv.ParseInt(line, 10, 32); err == nil {
+					pids = append(pids, int32(pid))
+				}
+			}
+
+			break
+		}
+	}
+
+	if len(pids) == 0 && unit.MainPID > 0 {
+		pids = append(pids, unit.MainPID)
+	}
+
+	return pids
+}
+
+func round(x float64) float64 {
+	return math.Round(x*100) / 100
+}
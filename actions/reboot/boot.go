@@ -0,0 +1,331 @@
+package reboot
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/byuoitav/common/log"
+	"github.com/byuoitav/common/nerr"
+	"github.com/byuoitav/device-monitoring/localsystem"
+)
+
+const (
+	// Requested means the device was rebooted through this service
+	Requested = "requested"
+
+	// Manual means the device was shut down cleanly, but not by this service (ie, someone ran `reboot`)
+	Manual = "manual"
+
+	// KernelPanic means the kernel panicked
+	KernelPanic = "kernel-panic"
+
+	// Watchdog means a watchdog reset the device
+	Watchdog = "watchdog"
+
+	// PowerLoss means the device lost power (or was otherwise reset without shutting down)
+	PowerLoss = "power-loss"
+
+	// Unknown means there wasn't enough information to tell why the device rebooted
+	Unknown = "unknown"
+
+	// LastSeenFile is the file in the data directory the last time this service saw the device running is saved in
+	LastSeenFile = "last-seen.json"
+
+	// HeartbeatInterval is how often LastSeenFile is updated
+	HeartbeatInterval = time.Minute
+
+	bootIDPath = "/proc/sys/kernel/random/boot_id"
+	pstorePath = "/sys/fs/pstore"
+
+	// the pi's firmware reports the reason for the last reset here
+	resetStatusPath = "/proc/device-tree/chosen/bootloader/rsts"
+
+	// the bit in rsts set when the watchdog reset the device
+	resetStatusWatchdog = 1 << 5
+)
+
+// lines in the journal that mean the device was shut down on purpose
+var shutdownMarkers = []string{
+	"Reached target Reboot",
+	"Reached target Power-Off",
+	"Reached target Shutdown",
+	"systemd-shutdown",
+}
+
+// lines in the journal that mean a watchdog was about to reset the device
+var watchdogMarkers = []string{
+	"watchdog did not stop",
+	"Watchdog timeout",
+	"watchdog0: watchdog",
+}
+
+// LastSeen is the last time the device was seen running
+type LastSeen struct {
+	Timestamp time.Time `json:"timestamp"`
+	BootID    string    `json:"boot-id"`
+	Uptime    string    `json:"uptime"`
+}
+
+// Boot is information about why the device last booted
+type Boot struct {
+	Reason   string    `json:"reason"`
+	BootID   string    `json:"boot-id"`
+	BootedAt time.Time `json:"booted-at"`
+
+	// Request is the reboot request, if the reboot was requested through this service
+	Request *Pending `json:"request,omitempty"`
+
+	// LastSeen is the last time the device was seen running before it rebooted
+	LastSeen *time.Time `json:"last-seen,omitempty"`
+
+	// PreviousUptime is how long the device was up before it rebooted
+	PreviousUptime string `json:"previous-uptime,omitempty"`
+
+	// Offline is how long the device was down
+	Offline string `json:"offline,omitempty"`
+
+	// Evidence is what the reason is based on
+	Evidence []string `json:"evidence,omitempty"`
+}
+
+// CheckBoot figures out why the device last booted. ok is false if the device hasn't rebooted since
+// the last time this service ran (ie, only the service was restarted)
+func CheckBoot(ctx context.Context) (boot Boot, ok bool, err *nerr.E) {
+	bootID, uptime, err := currentBoot()
+	if err != nil {
+		return boot, false, err.Addf("unable to check boot")
+	}
+
+	boot = Boot{
+		Reason:   Unknown,
+		BootID:   bootID,
+		BootedAt: time.Now().Add(-uptime).Truncate(time.Second),
+	}
+
+	lastSeen, lerr := readLastSeen()
+	switch {
+	case lerr != nil:
+		boot.Evidence = append(boot.Evidence, "the last time the device was running isn't known")
+	case lastSeen.BootID == bootID:
+		return boot, false, nil
+	default:
+		boot.LastSeen = &lastSeen.Timestamp
+		boot.PreviousUptime = lastSeen.Uptime
+
+		if offline := boot.BootedAt.Sub(lastSeen.Timestamp); offline > 0 {
+			boot.Offline = offline.Truncate(time.Second).String()
+		}
+	}
+
+	// the reason we saved right before rebooting. it's only trusted if the device didn't keep running after it was saved
+	if req, rerr := LastReason(); rerr == nil {
+		if lerr != nil || !req.At.Before(lastSeen.Timestamp.Add(-HeartbeatInterval)) {
+			boot.Request = &req
+		}
+
+		if err := ClearLastReason(); err != nil {
+			log.L.Warnf("%s", err.Error())
+		}
+	}
+
+	switch {
+	case boot.Request != nil && boot.Request.RequestedBy == WatchdogRequester:
+		boot.Reason = Watchdog
+		boot.Evidence = append(boot.Evidence, boot.Request.Reason)
+		return boot, true, nil
+	case boot.Request != nil:
+		boot.Reason = Requested
+		boot.Evidence = append(boot.Evidence, "a reboot was requested: "+boot.Request.Reason)
+		return boot, true, nil
+	}
+
+	// pstore keeps entries until they're deleted, so only the ones written after the device was last seen are from this reboot
+	var since time.Time
+	if lerr == nil {
+		since = lastSeen.Timestamp
+	}
+
+	if panics := pstorePanics(since); len(panics) > 0 {
+		boot.Reason = KernelPanic
+		boot.Evidence = append(boot.Evidence, panics...)
+		return boot, true, nil
+	}
+
+	if watchdogReset() {
+		boot.Reason = Watchdog
+		boot.Evidence = append(boot.Evidence, "the firmware reported a watchdog reset")
+		return boot, true, nil
+	}
+
+	journal, jerr := previousBootJournal(ctx)
+	if jerr != nil {
+		boot.Evidence = append(boot.Evidence, "the journal from the previous boot isn't available")
+		return boot, true, nil
+	}
+
+	if line := find(journal, shutdownMarkers); len(line) > 0 {
+		boot.Reason = Manual
+		boot.Evidence = append(boot.Evidence, line)
+		return boot, true, nil
+	}
+
+	if line := find(journal, watchdogMarkers); len(line) > 0 {
+		boot.Reason = Watchdog
+		boot.Evidence = append(boot.Evidence, line)
+		return boot, true, nil
+	}
+
+	boot.Reason = PowerLoss
+	boot.Evidence = append(boot.Evidence, "the previous boot ended without shutting down")
+
+	if line := find(journal, []string{"Under-voltage detected"}); len(line) > 0 {
+		boot.Evidence = append(boot.Evidence, line)
+	}
+
+	return boot, true, nil
+}
+
+// Heartbeat saves the last time the device was seen running every HeartbeatInterval until ctx is cancelled
+func Heartbeat(ctx context.Context) {
+	ticker := time.NewTicker(HeartbeatInterval)
+	defer ticker.Stop()
+
+	for {
+		if err := saveLastSeen(); err != nil {
+			log.L.Warnf("%s", err.Error())
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func currentBoot() (string, time.Duration, *nerr.E) {
+	b, err := ioutil.ReadFile(bootIDPath)
+	if err != nil {
+		return "", 0, nerr.Translate(err).Addf("unable to get boot id")
+	}
+
+	uptime, err := ioutil.ReadFile("/proc/uptime")
+	if err != nil {
+		return "", 0, nerr.Translate(err).Addf("unable to get uptime")
+	}
+
+	fields := strings.Fields(string(uptime))
+	if len(fields) == 0 {
+		return "", 0, nerr.Create("unable to get uptime: /proc/uptime is empty", "error")
+	}
+
+	secs, err := strconv.ParseFloat(fields[0], 64)
+	if err != nil {
+		return "", 0, nerr.Translate(err).Addf("unable to get uptime")
+	}
+
+	return strings.TrimSpace(string(b)), time.Duration(secs * float64(time.Second)), nil
+}
+
+func readLastSeen() (LastSeen, *nerr.E) {
+	var seen LastSeen
+
+	b, err := ioutil.ReadFile(localsystem.DataPath(LastSeenFile))
+	if err != nil {
+		return seen, nerr.Translate(err).Addf("unable to read last seen")
+	}
+
+	if err := json.Unmarshal(b, &seen); err != nil {
+		return seen, nerr.Translate(err).Addf("unable to read last seen")
+	}
+
+	return seen, nil
+}
+
+func saveLastSeen() *nerr.E {
+	bootID, uptime, err := currentBoot()
+	if err != nil {
+		return err.Addf("unable to save last seen")
+	}
+
+	b, gerr := json.Marshal(LastSeen{
+		Timestamp: time.Now(),
+		BootID:    bootID,
+		Uptime:    uptime.Truncate(time.Second).String(),
+	})
+	if gerr != nil {
+		return nerr.Translate(gerr).Addf("unable to save last seen")
+	}
+
+	if gerr := localsystem.WriteData(LastSeenFile, b); gerr != nil {
+		return nerr.Translate(gerr).Addf("unable to save last seen")
+	}
+
+	return nil
+}
+
+// pstorePanics returns the panic messages the kernel saved in pstore after since
+func pstorePanics(since time.Time) []string {
+	files, err := ioutil.ReadDir(pstorePath)
+	if err != nil {
+		return nil
+	}
+
+	var panics []string
+	for _, file := range files {
+		if !strings.HasPrefix(file.Name(), "dmesg") || !file.ModTime().After(since) {
+			continue
+		}
+
+		b, err := ioutil.ReadFile(filepath.Join(pstorePath, file.Name()))
+		if err != nil {
+			continue
+		}
+
+		if line := find(strings.Split(string(b), "\n"), []string{"Kernel panic", "Oops"}); len(line) > 0 {
+			panics = append(panics, line)
+		}
+	}
+
+	return panics
+}
+
+func watchdogReset() bool {
+	b, err := ioutil.ReadFile(resetStatusPath)
+	if err != nil || len(b) < 4 {
+		return false
+	}
+
+	// it's a big endian 32 bit int
+	rsts := uint32(b[0])<<24 | uint32(b[1])<<16 | uint32(b[2])<<8 | uint32(b[3])
+	return rsts&resetStatusWatchdog != 0
+}
+
+// previousBootJournal returns the end of the journal from the previous boot. it's only available if the journal is persistent
+func previousBootJournal(ctx context.Context) ([]string, *nerr.E) {
+	out, err := exec.CommandContext(ctx, "journalctl", "--boot=-1", "--lines=200", "--output=cat", "--no-pager").Output()
+	if err != nil {
+		return nil, nerr.Translate(err).Addf("unable to read the journal from the previous boot")
+	}
+
+	return strings.Split(string(out), "\n"), nil
+}
+
+// find returns the last line that contains one of markers
+func find(lines []string, markers []string) string {
+	for i := len(lines) - 1; i >= 0; i-- {
+		for _, marker := range markers {
+			if strings.Contains(lines[i], marker) {
+				return strings.TrimSpace(lines[i])
+			}
+		}
+	}
+
+	return ""
+}
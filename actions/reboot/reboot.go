@@ -0,0 +1,352 @@
+package reboot
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/byuoitav/common/log"
+	"github.com/byuoitav/common/nerr"
+	"github.com/byuoitav/common/v2/events"
+	"github.com/byuoitav/device-monitoring/actions/roomstate"
+	"github.com/byuoitav/device-monitoring/audit"
+	"github.com/byuoitav/device-monitoring/localsystem"
+	"github.com/byuoitav/device-monitoring/messenger"
+)
+
+const (
+	// DefaultDelay is how long to wait before rebooting if a time isn't given, so that there is a chance to cancel it
+	DefaultDelay = 5 * time.Second
+
+	// ReasonFile is the file in the data directory the reason for the last reboot is saved in
+	ReasonFile = "reboot-reason.json"
+
+	// WatchdogResetsFile is the file in the data directory the times the watchdog reset the device are saved in
+	WatchdogResetsFile = "watchdog-resets.json"
+
+	// the most watchdog resets that are remembered
+	maxWatchdogResets = 100
+
+	// WatchdogRequester is who is recorded as requesting the reboot when the watchdog stops being fed
+	WatchdogRequester = "watchdog"
+
+	roomStateTimeout = 10 * time.Second
+
+	// how far in the past a reboot can be requested for (ie, ?in=0s) and still happen now
+	pastTolerance = 5 * time.Second
+)
+
+// Request is a request to reboot the device
+type Request struct {
+	Reason      string `json:"reason,omitempty"`
+	RequestedBy string `json:"requested-by,omitempty"`
+
+	// At is when to reboot. if it's zero, the device reboots after DefaultDelay
+	At time.Time `json:"at,omitempty"`
+
+	// Force reboots the device even if the room is in use
+	Force bool `json:"force,omitempty"`
+}
+
+// Pending is a scheduled reboot
+type Pending struct {
+	Request
+	RequestedAt time.Time `json:"requested-at"`
+
+	timer *time.Timer
+}
+
+var (
+	pending   *Pending
+	pendingMu sync.Mutex
+)
+
+// Schedule schedules a reboot, replacing the one that is already scheduled.
+// unless req.Force is set, the reboot is refused if the room is in use now, and is cancelled if the room is in use when it's time to reboot.
+func Schedule(ctx context.Context, req Request) (Pending, *nerr.E) {
+	now := time.Now()
+	if req.At.IsZero() {
+		req.At = now.Add(DefaultDelay)
+	}
+
+	switch {
+	case req.At.Before(now.Add(-pastTolerance)):
+		return Pending{}, nerr.Createf("invalid", "unable to schedule reboot: %s is in the past", req.At.Format(time.RFC3339))
+	case req.At.Before(now):
+		req.At = now
+	}
+
+	if len(req.Reason) == 0 {
+		req.Reason = "unspecified"
+	}
+
+	if !req.Force {
+		if inUse, err := roomInUse(ctx); err != nil {
+			return Pending{}, err.Addf("unable to schedule reboot")
+		} else if len(inUse) > 0 {
+			return Pending{}, nerr.Createf("in-use", "unable to schedule reboot: the room is in use (%s are on)", strings.Join(inUse, ", "))
+		}
+	}
+
+	pendingMu.Lock()
+	defer pendingMu.Unlock()
+
+	if pending != nil {
+		pending.timer.Stop()
+		sendEvent("reboot-cancelled", *pending, "replaced by a new reboot request")
+	}
+
+	p := &Pending{
+		Request:     req,
+		RequestedAt: now,
+	}
+
+	p.timer = time.AfterFunc(time.Until(req.At), func() {
+		reboot(p)
+	})
+
+	pending = p
+
+	log.L.Infof("Reboot scheduled for %s by %s: %s", req.At.Format(time.RFC3339), req.RequestedBy, req.Reason)
+	sendEvent("reboot-requested", *p, req.Reason)
+
+	return *p, nil
+}
+
+// Cancel cancels the scheduled reboot
+func Cancel(reason string) (Pending, *nerr.E) {
+	pendingMu.Lock()
+	defer pendingMu.Unlock()
+
+	if pending == nil {
+		return Pending{}, nerr.Create("no reboot is scheduled", "not-found")
+	}
+
+	p := *pending
+	pending.timer.Stop()
+	pending = nil
+
+	log.L.Infof("Reboot scheduled for %s was cancelled: %s", p.At.Format(time.RFC3339), reason)
+	sendEvent("reboot-cancelled", p, reason)
+
+	return p, nil
+}
+
+// Scheduled returns the scheduled reboot, or nil if there isn't one
+func Scheduled() *Pending {
+	pendingMu.Lock()
+	defer pendingMu.Unlock()
+
+	if pending == nil {
+		return nil
+	}
+
+	p := *pending
+	return &p
+}
+
+func reboot(p *Pending) {
+	pendingMu.Lock()
+	if pending != p {
+		// it was cancelled or replaced
+		pendingMu.Unlock()
+		return
+	}
+
+	pending = nil
+	pendingMu.Unlock()
+
+	if !p.Force {
+		ctx, cancel := context.WithTimeout(context.Background(), roomStateTimeout)
+		inUse, err := roomInUse(ctx)
+		cancel()
+
+		switch {
+		case err != nil:
+			log.L.Warnf("cancelling reboot: %s", err.Error())
+			sendEvent("reboot-cancelled", *p, fmt.Sprintf("unable to check if the room is in use: %s", err.Error()))
+			return
+		case len(inUse) > 0:
+			log.L.Warnf("cancelling reboot: the room is in use (%s are on)", strings.Join(inUse, ", "))
+			sendEvent("reboot-cancelled", *p, fmt.Sprintf("the room is in use (%s are on)", strings.Join(inUse, ", ")))
+			return
+		}
+	}
+
+	if err := saveReason(*p); err != nil {
+		log.L.Warnf("unable to save reboot reason: %s", err.Error())
+	}
+
+	params := map[string]string{
+		"reason": p.Reason,
+		"force":  fmt.Sprintf("%v", p.Force),
+	}
+
+	// write to the audit log before rebooting, since nothing is written after
+	audit.Record("reboot", p.RequestedBy, params, nil)
+
+	if err := localsystem.Reboot(); err != nil {
+		log.L.Errorf("failed to reboot: %s", err.Error())
+		audit.Record("reboot", p.RequestedBy, params, err)
+	}
+}
+
+// roomInUse returns the displays in the room that are on
+func roomInUse(ctx context.Context) ([]string, *nerr.E) {
+	roomID, err := localsystem.RoomID()
+	if err != nil {
+		return nil, err.Addf("unable to check if the room is in use")
+	}
+
+	state, err := roomstate.Get(ctx, roomID)
+	if err != nil {
+		return nil, err.Addf("unable to check if the room is in use")
+	}
+
+	var on []string
+	for _, display := range state.Displays {
+		if strings.EqualFold(display.Power, "on") {
+			on = append(on, display.Name)
+		}
+	}
+
+	return on, nil
+}
+
+// LastReason returns the reason saved before the last reboot that this service triggered
+func LastReason() (Pending, *nerr.E) {
+	var p Pending
+
+	b, err := ioutil.ReadFile(localsystem.DataPath(ReasonFile))
+	if err != nil {
+		return p, nerr.Translate(err).Addf("unable to read last reboot reason")
+	}
+
+	if err := json.Unmarshal(b, &p); err != nil {
+		return p, nerr.Translate(err).Addf("unable to read last reboot reason")
+	}
+
+	return p, nil
+}
+
+// ClearLastReason removes the saved reason so that it isn't reported after a later, unrequested reboot
+func ClearLastReason() *nerr.E {
+	if err := os.Remove(localsystem.DataPath(ReasonFile)); err != nil && !os.IsNotExist(err) {
+		return nerr.Translate(err).Addf("unable to clear last reboot reason")
+	}
+
+	return nil
+}
+
+// RecordWatchdog saves the reason the watchdog is about to reset the device, so that it can be reported after it boots
+func RecordWatchdog(reason string) *nerr.E {
+	now := time.Now()
+
+	err := saveReason(Pending{
+		Request: Request{
+			Reason:      reason,
+			RequestedBy: WatchdogRequester,
+			At:          now,
+			Force:       true,
+		},
+		RequestedAt: now,
+	})
+	if err != nil {
+		return err.Addf("unable to record watchdog reason")
+	}
+
+	resets, _ := watchdogResets()
+	resets = append(resets, now)
+	if len(resets) > maxWatchdogResets {
+		resets = resets[len(resets)-maxWatchdogResets:]
+	}
+
+	b, gerr := json.Marshal(resets)
+	if gerr != nil {
+		return nerr.Translate(gerr).Addf("unable to record watchdog reset")
+	}
+
+	if gerr := localsystem.WriteData(WatchdogResetsFile, b); gerr != nil {
+		return nerr.Translate(gerr).Addf("unable to record watchdog reset")
+	}
+
+	localsystem.Sync()
+	return nil
+}
+
+// WatchdogResets returns how many times the watchdog has reset the device since since
+func WatchdogResets(since time.Time) (int, *nerr.E) {
+	resets, err := watchdogResets()
+	if err != nil {
+		return 0, err
+	}
+
+	count := 0
+	for _, t := range resets {
+		if t.After(since) {
+			count++
+		}
+	}
+
+	return count, nil
+}
+
+func watchdogResets() ([]time.Time, *nerr.E) {
+	var resets []time.Time
+
+	b, err := ioutil.ReadFile(localsystem.DataPath(WatchdogResetsFile))
+	switch {
+	case os.IsNotExist(err):
+		return nil, nil
+	case err != nil:
+		return nil, nerr.Translate(err).Addf("unable to read watchdog resets")
+	}
+
+	if err := json.Unmarshal(b, &resets); err != nil {
+		return nil, nerr.Translate(err).Addf("unable to read watchdog resets")
+	}
+
+	return resets, nil
+}
+
+func saveReason(p Pending) *nerr.E {
+	b, err := json.Marshal(p)
+	if err != nil {
+		return nerr.Translate(err).Addf("unable to save reboot reason")
+	}
+
+	if err := localsystem.WriteData(ReasonFile, b); err != nil {
+		return nerr.Translate(err).Addf("unable to save reboot reason")
+	}
+
+	return nil
+}
+
+func sendEvent(key string, p Pending, value string) {
+	systemID, err := localsystem.SystemID()
+	if err != nil {
+		log.L.Warnf("unable to send %s event: %s", key, err.Error())
+		return
+	}
+
+	deviceInfo := events.GenerateBasicDeviceInfo(systemID)
+
+	messenger.Get().SendEvent(events.Event{
+		GeneratingSystem: systemID,
+		Timestamp:        time.Now(),
+		EventTags: []string{
+			events.DetailState,
+		},
+		TargetDevice: deviceInfo,
+		AffectedRoom: deviceInfo.BasicRoomInfo,
+		Key:          key,
+		Value:        value,
+		User:         p.RequestedBy,
+		Data:         p,
+	})
+}
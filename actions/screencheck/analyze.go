@@ -0,0 +1,98 @@
+package screencheck
+
+import (
+	"fmt"
+	"image"
+	"math"
+	"os"
+
+	// register the formats templates can be in
+	_ "image/jpeg"
+	_ "image/png"
+
+	"github.com/byuoitav/common/nerr"
+	"golang.org/x/image/draw"
+)
+
+const (
+	// frames are compared at this size, so that small changes (ie, a blinking cursor) and scaling artifacts don't matter
+	sampleWidth  = 64
+	sampleHeight = 36
+)
+
+// sample is a small grayscale copy of a frame
+type sample []float64
+
+// newSample scales img down to sampleWidth x sampleHeight, and converts it to grayscale
+func newSample(img image.Image) sample {
+	gray := image.NewGray(image.Rect(0, 0, sampleWidth, sampleHeight))
+	draw.BiLinear.Scale(gray, gray.Bounds(), img, img.Bounds(), draw.Src, nil)
+
+	s := make(sample, len(gray.Pix))
+	for i := range gray.Pix {
+		s[i] = float64(gray.Pix[i])
+	}
+
+	return s
+}
+
+// stats returns the mean and standard deviation of the brightness of s
+func (s sample) stats() (mean, stddev float64) {
+	for _, v := range s {
+		mean += v
+	}
+	mean /= float64(len(s))
+
+	for _, v := range s {
+		stddev += (v - mean) * (v - mean)
+	}
+
+	return mean, math.Sqrt(stddev / float64(len(s)))
+}
+
+// diff returns the mean absolute difference between s and o, from 0 (identical) to 255
+func (s sample) diff(o sample) float64 {
+	if len(s) != len(o) {
+		return 255
+	}
+
+	var total float64
+	for i := range s {
+		total += math.Abs(s[i] - o[i])
+	}
+
+	return total / float64(len(s))
+}
+
+// averageColor returns the average color of img as a hex string (ie, #ffffff)
+func averageColor(img image.Image) string {
+	small := image.NewRGBA(image.Rect(0, 0, sampleWidth, sampleHeight))
+	draw.BiLinear.Scale(small, small.Bounds(), img, img.Bounds(), draw.Src, nil)
+
+	var r, g, b int
+	for i := 0; i < len(small.Pix); i += 4 {
+		r += int(small.Pix[i])
+		g += int(small.Pix[i+1])
+		b += int(small.Pix[i+2])
+	}
+
+	n := len(small.Pix) / 4
+	return fmt.Sprintf("#%02x%02x%02x", r/n, g/n, b/n)
+}
+
+// load reads the template's image from disk
+func (t *Template) load() *nerr.E {
+	f, err := os.Open(t.Path)
+	if err != nil {
+		return nerr.Translate(err).Addf("unable to open template %s", t.Name)
+	}
+	defer f.Close()
+
+	img, _, err := image.Decode(f)
+	if err != nil {
+		return nerr.Translate(err).Addf("unable to decode template %s", t.Name)
+	}
+
+	t.sample = newSample(img)
+	return nil
+}
@@ -0,0 +1,328 @@
+package screencheck
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"image"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/byuoitav/common/nerr"
+	"github.com/byuoitav/device-monitoring/actions/screenshot"
+	"github.com/byuoitav/device-monitoring/localsystem"
+	"go.uber.org/zap"
+)
+
+const (
+	// OK means the screen looks normal
+	OK = "ok"
+
+	// Blank means the whole screen is (nearly) one color
+	Blank = "blank"
+
+	// Frozen means the screen hasn't changed in Config.FrozenIntervals checks
+	Frozen = "frozen"
+
+	// ErrorPage means the screen matches one of the templates
+	ErrorPage = "error-page"
+
+	defaultInterval        = time.Minute
+	defaultDir             = "/run/device-monitoring/screenshots"
+	defaultKeep            = 5
+	defaultBlankThreshold  = 3
+	defaultChangeThreshold = 1
+	defaultMatchThreshold  = 8
+	defaultThumbnailWidth  = 320
+	thumbnailQuality       = 70
+
+	framePrefix     = "screen-"
+	thumbnailPrefix = "thumbnail-"
+	frameLayout     = "20060102T150405"
+)
+
+// Config controls how often the screen is checked, and what counts as a problem
+type Config struct {
+	// Interval is how often a screenshot is taken. defaults to 1m
+	Interval string `json:"interval,omitempty"`
+
+	// Display and Output are which screen to check (see screenshot.Options)
+	Display string `json:"display,omitempty"`
+	Output  string `json:"output,omitempty"`
+
+	// Dir is where the last Keep screenshots are saved. a full screenshot is only saved when the state of the screen changes,
+	// and a thumbnail is saved otherwise. defaults to /run/device-monitoring/screenshots (a tmpfs); relative paths are in the data directory
+	Dir  string `json:"dir,omitempty"`
+	Keep int    `json:"keep,omitempty"`
+
+	// BlankThreshold is the most the brightness of a blank screen varies (its standard deviation, 0-255). defaults to 3
+	BlankThreshold float64 `json:"blank-threshold,omitempty"`
+
+	// ChangeThreshold is the least the screen must change (mean difference, 0-255) between checks to not count as unchanged. defaults to 1
+	ChangeThreshold float64 `json:"change-threshold,omitempty"`
+
+	// FrozenIntervals is how many checks in a row the screen must be unchanged to be frozen.
+	// an idle touch panel doesn't change either, so it's disabled unless it's set
+	FrozenIntervals int `json:"frozen-intervals,omitempty"`
+
+	// Templates are screens that are known to be errors (ie, chromium's crash page)
+	Templates []Template `json:"templates,omitempty"`
+
+	// ThumbnailWidth is the width of the thumbnail attached to each result. defaults to 320
+	ThumbnailWidth int `json:"thumbnail-width,omitempty"`
+
+	interval time.Duration
+}
+
+// Template is a screenshot of a known error page
+type Template struct {
+	Name string `json:"name"`
+	Path string `json:"path"`
+
+	// Threshold is the most a screen can differ (mean difference, 0-255) from the template and still match it. defaults to 8
+	Threshold float64 `json:"threshold,omitempty"`
+
+	sample sample
+}
+
+// Result is the state of the screen at one check
+type Result struct {
+	Timestamp time.Time `json:"timestamp"`
+	State     string    `json:"state"`
+
+	// Template is the template the screen matched, if the state is ErrorPage
+	Template string `json:"template,omitempty"`
+
+	// Color is the average color of the screen (ie, #ffffff)
+	Color      string  `json:"color"`
+	Brightness float64 `json:"brightness"`
+	Variation  float64 `json:"variation"`
+
+	// Change is how much the screen changed since the last check, and Unchanged is how many checks in a row it has been under Config.ChangeThreshold
+	Change    float64 `json:"change"`
+	Unchanged int     `json:"unchanged"`
+
+	// Path is where the screenshot (or thumbnail, if the state didn't change) was saved
+	Path string `json:"path,omitempty"`
+
+	// Thumbnail is a small jpeg of the screen, as a data uri
+	Thumbnail string `json:"thumbnail,omitempty"`
+}
+
+func (c *Config) setDefaults() *nerr.E {
+	c.interval = defaultInterval
+	if len(c.Interval) > 0 {
+		var err error
+
+		c.interval, err = time.ParseDuration(c.Interval)
+		if err != nil {
+			return nerr.Translate(err).Addf("invalid interval %q", c.Interval)
+		}
+	}
+
+	if len(c.Dir) == 0 {
+		c.Dir = defaultDir
+	}
+
+	c.Dir = localsystem.DataPath(c.Dir)
+
+	if c.Keep <= 0 {
+		c.Keep = defaultKeep
+	}
+
+	if c.BlankThreshold <= 0 {
+		c.BlankThreshold = defaultBlankThreshold
+	}
+
+	if c.ChangeThreshold <= 0 {
+		c.ChangeThreshold = defaultChangeThreshold
+	}
+
+	if c.ThumbnailWidth <= 0 {
+		c.ThumbnailWidth = defaultThumbnailWidth
+	}
+
+	for i := range c.Templates {
+		if c.Templates[i].Threshold <= 0 {
+			c.Templates[i].Threshold = defaultMatchThreshold
+		}
+
+		if err := c.Templates[i].load(); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Watch takes a screenshot every interval until ctx is cancelled, calling send each time the state of the screen changes
+func Watch(ctx context.Context, config Config, send func(Result), log *zap.SugaredLogger) *nerr.E {
+	if err := config.setDefaults(); err != nil {
+		return err.Addf("unable to watch screen")
+	}
+
+	if err := os.MkdirAll(config.Dir, 0755); err != nil {
+		return nerr.Translate(err).Addf("unable to watch screen")
+	}
+
+	ticker := time.NewTicker(config.interval)
+	defer ticker.Stop()
+
+	var prev sample
+	var unchanged int
+	state := ""
+
+	for {
+		img, err := screenshot.Capture(ctx, screenshot.Options{
+			Display: config.Display,
+			Output:  config.Output,
+		})
+		if err != nil {
+			log.Warnf("unable to check screen: %s", err.Error())
+		} else {
+			res, cur := analyze(img, prev, unchanged, config)
+			prev, unchanged = cur, res.Unchanged
+
+			changed := res.State != state
+
+			thumb, err := thumbnail(img, config.ThumbnailWidth)
+			if err != nil {
+				log.Warnf("unable to make thumbnail: %s", err.Error())
+			}
+
+			// full screenshots are only kept when something happened, so that the sd card/memory isn't filled with them
+			var path string
+			var serr *nerr.E
+
+			switch {
+			case changed:
+				path, serr = saveFrame(img, res.Timestamp, config)
+			case thumb != nil:
+				path, serr = save(thumb, thumbnailPrefix, res.Timestamp, config)
+			}
+
+			if serr != nil {
+				log.Warnf("unable to save screenshot: %s", serr.Error())
+			} else {
+				res.Path = path
+			}
+
+			if changed {
+				log.Infof("Screen is %s (was %q)", res.State, state)
+
+				if thumb != nil {
+					res.Thumbnail = "data:image/jpeg;base64," + base64.StdEncoding.EncodeToString(thumb)
+				}
+
+				send(res)
+				state = res.State
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// analyze decides the state of the screen in img, comparing it with the previous check
+func analyze(img image.Image, prev sample, unchanged int, config Config) (Result, sample) {
+	cur := newSample(img)
+	res := Result{
+		Timestamp: time.Now(),
+		State:     OK,
+		Color:     averageColor(img),
+		Change:    255,
+	}
+
+	res.Brightness, res.Variation = cur.stats()
+
+	if prev != nil {
+		res.Change = cur.diff(prev)
+	}
+
+	res.Unchanged = 0
+	if res.Change < config.ChangeThreshold {
+		res.Unchanged = unchanged + 1
+	}
+
+	for _, t := range config.Templates {
+		if cur.diff(t.sample) <= t.Threshold {
+			res.State = ErrorPage
+			res.Template = t.Name
+			return res, cur
+		}
+	}
+
+	switch {
+	case res.Variation <= config.BlankThreshold:
+		res.State = Blank
+	case config.FrozenIntervals > 0 && res.Unchanged >= config.FrozenIntervals:
+		res.State = Frozen
+	}
+
+	return res, cur
+}
+
+// saveFrame writes img to config.Dir, and removes all but the newest config.Keep screenshots
+func saveFrame(img image.Image, t time.Time, config Config) (string, *nerr.E) {
+	buf := &bytes.Buffer{}
+	if err := screenshot.Encode(buf, img, screenshot.JPEG, 0); err != nil {
+		return "", err
+	}
+
+	return save(buf.Bytes(), framePrefix, t, config)
+}
+
+// save writes the jpeg b to config.Dir, and removes all but the newest config.Keep files that start with prefix
+func save(b []byte, prefix string, t time.Time, config Config) (string, *nerr.E) {
+	path := filepath.Join(config.Dir, prefix+t.Format(frameLayout)+".jpg")
+
+	tmp := path + ".tmp"
+	if err := ioutil.WriteFile(tmp, b, 0644); err != nil {
+		return "", nerr.Translate(err).Addf("unable to write %s", path)
+	}
+
+	if err := os.Rename(tmp, path); err != nil {
+		return "", nerr.Translate(err).Addf("unable to write %s", path)
+	}
+
+	infos, err := ioutil.ReadDir(config.Dir)
+	if err != nil {
+		return path, nerr.Translate(err).Addf("unable to remove old screenshots")
+	}
+
+	var files []string
+	for _, info := range infos {
+		if strings.HasPrefix(info.Name(), prefix) && strings.HasSuffix(info.Name(), ".jpg") {
+			files = append(files, info.Name())
+		}
+	}
+
+	// the timestamp in the name sorts them oldest first
+	sort.Strings(files)
+
+	for i := 0; i < len(files)-config.Keep; i++ {
+		if err := os.Remove(filepath.Join(config.Dir, files[i])); err != nil {
+			return path, nerr.Translate(err).Addf("unable to remove old screenshots")
+		}
+	}
+
+	return path, nil
+}
+
+// thumbnail returns a small jpeg of img
+func thumbnail(img image.Image, width int) ([]byte, *nerr.E) {
+	buf := &bytes.Buffer{}
+	if err := screenshot.Encode(buf, screenshot.Scale(img, width), screenshot.JPEG, thumbnailQuality); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,91 @@
+package screenshot
+
+import (
+	"encoding/binary"
+	"image"
+	"image/color"
+	"math/bits"
+
+	"github.com/byuoitav/common/nerr"
+)
+
+// pixelFormat describes how the pixels in an x image are laid out
+type pixelFormat struct {
+	bitsPerPixel int
+	order        binary.ByteOrder
+
+	// the masks of a truecolor image
+	red, green, blue uint32
+
+	// colormap is used instead of the masks for a pseudocolor image
+	colormap map[uint32]color.RGBA
+}
+
+// toImage converts the raw pixels of an x image into an RGBA image
+func (f pixelFormat) toImage(data []byte, width, height, stride int) (*image.RGBA, *nerr.E) {
+	switch f.bitsPerPixel {
+	case 8, 16, 24, 32:
+	default:
+		return nil, nerr.Createf("error", "unsupported bits per pixel: %d", f.bitsPerPixel)
+	}
+
+	bytesPerPixel := f.bitsPerPixel / 8
+	if width*bytesPerPixel > stride || len(data) < stride*(height-1)+width*bytesPerPixel {
+		return nil, nerr.Createf("error", "image data is too short (%d bytes for %dx%d)", len(data), width, height)
+	}
+
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+
+	for y := 0; y < height; y++ {
+		row := data[y*stride:]
+
+		for x := 0; x < width; x++ {
+			p := f.pixel(row[x*bytesPerPixel:])
+
+			var c color.RGBA
+			if f.colormap != nil {
+				c = f.colormap[p]
+			} else {
+				c = color.RGBA{
+					R: channel(p, f.red),
+					G: channel(p, f.green),
+					B: channel(p, f.blue),
+					A: 0xff,
+				}
+			}
+
+			img.SetRGBA(x, y, c)
+		}
+	}
+
+	return img, nil
+}
+
+func (f pixelFormat) pixel(b []byte) uint32 {
+	switch f.bitsPerPixel {
+	case 8:
+		return uint32(b[0])
+	case 16:
+		return uint32(f.order.Uint16(b))
+	case 24:
+		if f.order == binary.BigEndian {
+			return uint32(b[0])<<16 | uint32(b[1])<<8 | uint32(b[2])
+		}
+
+		return uint32(b[2])<<16 | uint32(b[1])<<8 | uint32(b[0])
+	default:
+		return f.order.Uint32(b)
+	}
+}
+
+// channel scales the bits of p in mask to 0-255
+func channel(p, mask uint32) uint8 {
+	if mask == 0 {
+		return 0
+	}
+
+	shift := uint(bits.TrailingZeros32(mask))
+	max := mask >> shift
+
+	return uint8(((p & mask) >> shift) * 0xff / max)
+}
@@ -3,53 +3,210 @@ package screenshot
 import (
 	"bytes"
 	"context"
-	"os/exec"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"os"
+	"strconv"
+	"strings"
 
+	"github.com/HugoSmits86/nativewebp"
 	"github.com/byuoitav/common/log"
 	"github.com/byuoitav/common/nerr"
+	"golang.org/x/image/draw"
 )
 
-// Take .
-func Take(ctx context.Context) ([]byte, *nerr.E) {
-	log.L.Infof("Taking screenshot of the pi")
+const (
+	// PNG is a lossless png
+	PNG = "png"
+
+	// JPEG is a jpeg, encoded at Options.Quality
+	JPEG = "jpeg"
+
+	// WebP is a lossless webp
+	WebP = "webp"
+
+	// DefaultDisplay is captured if no display is given and $DISPLAY isn't set
+	DefaultDisplay = ":0"
 
-	// get the xwd dump
-	xwd := &bytes.Buffer{}
-	stderr := &bytes.Buffer{}
+	// DefaultQuality is the jpeg quality used if none is given
+	DefaultQuality = 85
+)
+
+// Options control what is captured and how it's encoded
+type Options struct {
+	// Display is the x display to capture (ie, :0 or :0.1 for the second screen)
+	Display string
 
-	cmd := exec.Command("/usr/bin/xwd", "-root", "-display", ":0")
-	cmd.Stdout = xwd
-	cmd.Stderr = stderr
-	// cmd.Env = []string{"DISPLAY=:0"}
+	// Output is the monitor to capture (ie, HDMI-1). if it's empty, the whole screen is captured
+	Output string
 
-	log.L.Debugf("Getting xwd screenshot with command: %s", cmd.Args)
+	// Region is the part of the screen (or output) to capture. if it's empty, everything is captured
+	Region image.Rectangle
 
-	err := cmd.Run()
+	Format  string
+	Quality int
+
+	// MaxWidth scales the image down to at most this width, keeping its aspect ratio
+	MaxWidth int
+}
+
+// Take captures the screen and encodes it, returning the image and its content type
+func Take(ctx context.Context, opts Options) ([]byte, string, *nerr.E) {
+	log.L.Infof("Taking screenshot of the pi")
+
+	img, err := Capture(ctx, opts)
 	if err != nil {
-		if stderr.Len() > 0 {
-			return []byte{}, nerr.Translate(err).Addf("unable to take a screenshot: %s", stderr)
+		return nil, "", err.Addf("unable to take screenshot")
+	}
+
+	buf := &bytes.Buffer{}
+	if err := Encode(buf, Scale(img, opts.MaxWidth), opts.Format, opts.Quality); err != nil {
+		return nil, "", err.Addf("unable to take screenshot")
+	}
+
+	log.L.Debugf("Successfully took screenshot.")
+	return buf.Bytes(), ContentType(opts.Format), nil
+}
+
+// Capture reads the screen from the x server, falling back to xwd if the x server can't be reached directly
+func Capture(ctx context.Context, opts Options) (*image.RGBA, *nerr.E) {
+	x := &x11Conn{display: display(opts)}
+	defer x.close()
+
+	return capture(ctx, opts, x)
+}
+
+// capture is Capture, using x to read from the x server
+func capture(ctx context.Context, opts Options, x *x11Conn) (*image.RGBA, *nerr.E) {
+	img, err := x.capture(ctx, opts.Output, opts.Region)
+	switch {
+	case err == nil:
+		return img, nil
+	case err.Type == "invalid":
+		return nil, err
+	case len(opts.Output) > 0:
+		// xwd can't find outputs
+		return nil, err
+	}
+
+	log.L.Debugf("unable to capture x display directly, trying xwd: %s", err.Error())
+
+	img, xerr := captureXWD(ctx, x.display)
+	if xerr != nil {
+		return nil, err.Addf("unable to capture with xwd: %s", xerr.Error())
+	}
+
+	if !opts.Region.Empty() {
+		region := opts.Region.Intersect(img.Bounds())
+		if region.Empty() {
+			return nil, nerr.Create("region is outside of the screen", "invalid")
 		}
 
-		return []byte{}, nerr.Translate(err).Addf("unable to take a screenshot")
+		img = img.SubImage(region).(*image.RGBA)
 	}
 
-	// convert the xwd dump to a jpg
-	jpg := &bytes.Buffer{}
-	cmd = exec.Command("/usr/bin/convert", "xwd:-", "jpg:-")
-	cmd.Stdin = xwd
-	cmd.Stdout = jpg
-	cmd.Stderr = stderr
+	return img, nil
+}
+
+// display returns the x display opts are for
+func display(opts Options) string {
+	switch {
+	case len(opts.Display) > 0:
+		return opts.Display
+	case len(os.Getenv("DISPLAY")) > 0:
+		return os.Getenv("DISPLAY")
+	default:
+		return DefaultDisplay
+	}
+}
+
+// Scale scales img down to maxWidth, keeping its aspect ratio. it's returned as is if it's already small enough
+func Scale(img image.Image, maxWidth int) image.Image {
+	bounds := img.Bounds()
+	if maxWidth <= 0 || bounds.Dx() <= maxWidth {
+		return img
+	}
+
+	height := bounds.Dy() * maxWidth / bounds.Dx()
+	if height < 1 {
+		height = 1
+	}
+
+	scaled := image.NewRGBA(image.Rect(0, 0, maxWidth, height))
+	draw.ApproxBiLinear.Scale(scaled, scaled.Bounds(), img, bounds, draw.Src, nil)
+
+	return scaled
+}
+
+// Encode writes img to w in format
+func Encode(w io.Writer, img image.Image, format string, quality int) *nerr.E {
+	if quality <= 0 {
+		quality = DefaultQuality
+	}
+
+	format = ParseFormat(format)
+
+	var err error
+
+	switch format {
+	case PNG:
+		err = png.Encode(w, img)
+	case WebP:
+		err = nativewebp.Encode(w, img, nil)
+	case JPEG:
+		err = jpeg.Encode(w, img, &jpeg.Options{Quality: quality})
+	default:
+		return nerr.Createf("invalid", "unsupported image format %q", format)
+	}
 
-	log.L.Debugf("Converting xwd screenshot to jpg with command: %s", cmd.Args)
-	err = cmd.Run()
 	if err != nil {
-		if stderr.Len() > 0 {
-			return []byte{}, nerr.Translate(err).Addf("unable to take screenshot: %s", stderr)
+		return nerr.Translate(err).Addf("unable to encode %s", format)
+	}
+
+	return nil
+}
+
+// ParseFormat returns the format matching s (ie, jpg is JPEG). an empty string is JPEG
+func ParseFormat(s string) string {
+	switch strings.ToLower(s) {
+	case "", "jpg", JPEG:
+		return JPEG
+	case PNG:
+		return PNG
+	case WebP:
+		return WebP
+	default:
+		return s
+	}
+}
+
+// ContentType returns the content type of format
+func ContentType(format string) string {
+	return "image/" + ParseFormat(format)
+}
+
+// ParseRegion parses a region in the form x,y,width,height
+func ParseRegion(s string) (image.Rectangle, *nerr.E) {
+	split := strings.Split(s, ",")
+	if len(split) != 4 {
+		return image.Rectangle{}, nerr.Createf("invalid", "invalid region %q: must be x,y,width,height", s)
+	}
+
+	var vals [4]int
+	for i := range split {
+		var err error
+
+		vals[i], err = strconv.Atoi(strings.TrimSpace(split[i]))
+		if err != nil || vals[i] < 0 {
+			return image.Rectangle{}, nerr.Createf("invalid", "invalid region %q: must be x,y,width,height", s)
 		}
+	}
 
-		return []byte{}, nerr.Translate(err).Addf("unable to take screenshot")
+	if vals[2] == 0 || vals[3] == 0 {
+		return image.Rectangle{}, nerr.Createf("invalid", "invalid region %q: width and height must be greater than 0", s)
 	}
 
-	log.L.Debugf("Successfully took screenshot.")
-	return jpg.Bytes(), nil
+	return image.Rect(vals[0], vals[1], vals[0]+vals[2], vals[1]+vals[3]), nil
 }
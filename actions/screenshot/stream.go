@@ -0,0 +1,160 @@
+package screenshot
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/byuoitav/common/log"
+)
+
+// MaxFPS is the fastest a stream can be captured
+const MaxFPS = 10
+
+// Frame is one encoded frame of a stream
+type Frame struct {
+	Data        []byte
+	ContentType string
+	Timestamp   time.Time
+}
+
+// stream captures frames while anyone is watching it
+type stream struct {
+	key      string
+	opts     Options
+	interval time.Duration
+
+	viewers   map[chan Frame]bool
+	viewersMu sync.Mutex
+	cancel    context.CancelFunc
+}
+
+var (
+	streams   = make(map[string]*stream)
+	streamsMu sync.Mutex
+)
+
+// Subscribe returns the frames of the screen captured with opts at fps, and a func to call when done watching.
+// viewers with the same options share a stream, and the screen is only captured while a stream has viewers
+func Subscribe(opts Options, fps int) (<-chan Frame, func()) {
+	if fps <= 0 {
+		fps = 1
+	}
+
+	if fps > MaxFPS {
+		fps = MaxFPS
+	}
+
+	key := fmt.Sprintf("%+v/%d", opts, fps)
+	ch := make(chan Frame, 1)
+
+	streamsMu.Lock()
+	defer streamsMu.Unlock()
+
+	s, ok := streams[key]
+	if !ok {
+		ctx, cancel := context.WithCancel(context.Background())
+
+		s = &stream{
+			key:      key,
+			opts:     opts,
+			interval: time.Second / time.Duration(fps),
+			viewers:  make(map[chan Frame]bool),
+			cancel:   cancel,
+		}
+
+		streams[key] = s
+		go s.run(ctx)
+
+		log.L.Infof("Starting screen stream %s", key)
+	}
+
+	s.viewersMu.Lock()
+	s.viewers[ch] = true
+	s.viewersMu.Unlock()
+
+	var once sync.Once
+	return ch, func() {
+		once.Do(func() {
+			s.unsubscribe(ch)
+		})
+	}
+}
+
+func (s *stream) unsubscribe(ch chan Frame) {
+	streamsMu.Lock()
+	defer streamsMu.Unlock()
+
+	s.viewersMu.Lock()
+	defer s.viewersMu.Unlock()
+
+	delete(s.viewers, ch)
+
+	if len(s.viewers) == 0 {
+		log.L.Infof("Stopping screen stream %s", s.key)
+
+		s.cancel()
+		delete(streams, s.key)
+	}
+}
+
+func (s *stream) run(ctx context.Context) {
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+
+	// every frame is read over the same connection, which is only reopened if a capture fails
+	x := &x11Conn{display: display(s.opts)}
+	defer x.close()
+
+	for {
+		if frame, ok := s.capture(ctx, x); ok {
+			s.send(frame)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (s *stream) capture(ctx context.Context, x *x11Conn) (Frame, bool) {
+	img, err := capture(ctx, s.opts, x)
+	if err != nil {
+		log.L.Warnf("unable to capture frame for screen stream: %s", err.Error())
+		return Frame{}, false
+	}
+
+	buf := &bytes.Buffer{}
+	if err := Encode(buf, Scale(img, s.opts.MaxWidth), s.opts.Format, s.opts.Quality); err != nil {
+		log.L.Warnf("unable to encode frame for screen stream: %s", err.Error())
+		return Frame{}, false
+	}
+
+	return Frame{
+		Data:        buf.Bytes(),
+		ContentType: ContentType(s.opts.Format),
+		Timestamp:   time.Now(),
+	}, true
+}
+
+// send gives frame to each viewer, replacing the frame they haven't read yet so that slow viewers don't fall behind
+func (s *stream) send(frame Frame) {
+	s.viewersMu.Lock()
+	defer s.viewersMu.Unlock()
+
+	for ch := range s.viewers {
+		select {
+		case <-ch:
+		default:
+		}
+
+		select {
+		case ch <- frame:
+		default:
+		}
+	}
+}
@@ -0,0 +1,189 @@
+package screenshot
+
+import (
+	"context"
+	"encoding/binary"
+	"image"
+	"strings"
+
+	"github.com/BurntSushi/xgb"
+	"github.com/BurntSushi/xgb/randr"
+	"github.com/BurntSushi/xgb/xproto"
+	"github.com/byuoitav/common/nerr"
+)
+
+// x11Conn is a connection to an x display that's kept open between captures. it connects on the first capture,
+// and reconnects on the next one if a capture fails
+type x11Conn struct {
+	display string
+	conn    *xgb.Conn
+}
+
+// capture reads the screen directly from the x server
+func (x *x11Conn) capture(ctx context.Context, output string, region image.Rectangle) (*image.RGBA, *nerr.E) {
+	if x.conn == nil {
+		conn, err := xgb.NewConnDisplay(x.display)
+		if err != nil {
+			return nil, nerr.Translate(err).Addf("unable to connect to x display %s", x.display)
+		}
+
+		x.conn = conn
+	}
+
+	type result struct {
+		img *image.RGBA
+		err *nerr.E
+	}
+
+	// xgb doesn't take a context, so closing the connection is the only way to stop waiting on it
+	done := make(chan result, 1)
+	go func(conn *xgb.Conn) {
+		img, err := getImage(conn, output, region)
+		done <- result{img, err}
+	}(x.conn)
+
+	select {
+	case <-ctx.Done():
+		x.close()
+		return nil, nerr.Translate(ctx.Err()).Addf("unable to capture x display %s", x.display)
+	case res := <-done:
+		// an invalid request doesn't mean anything is wrong with the connection
+		if res.err != nil && res.err.Type != "invalid" {
+			x.close()
+		}
+
+		return res.img, res.err
+	}
+}
+
+func (x *x11Conn) close() {
+	if x.conn != nil {
+		x.conn.Close()
+		x.conn = nil
+	}
+}
+
+func getImage(conn *xgb.Conn, output string, region image.Rectangle) (*image.RGBA, *nerr.E) {
+	setup := xproto.Setup(conn)
+	if conn.DefaultScreen >= len(setup.Roots) {
+		return nil, nerr.Createf("invalid", "screen %d doesn't exist (the display has %d)", conn.DefaultScreen, len(setup.Roots))
+	}
+
+	screen := setup.Roots[conn.DefaultScreen]
+	bounds := image.Rect(0, 0, int(screen.WidthInPixels), int(screen.HeightInPixels))
+
+	if len(output) > 0 {
+		var err *nerr.E
+
+		bounds, err = outputBounds(conn, screen.Root, output)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// the region is relative to the screen (or output)
+	if !region.Empty() {
+		bounds = region.Add(bounds.Min).Intersect(bounds)
+		if bounds.Empty() {
+			return nil, nerr.Create("region is outside of the screen", "invalid")
+		}
+	}
+
+	format, err := x11PixelFormat(setup, screen)
+	if err != nil {
+		return nil, err
+	}
+
+	reply, gerr := xproto.GetImage(conn, xproto.ImageFormatZPixmap, xproto.Drawable(screen.Root),
+		int16(bounds.Min.X), int16(bounds.Min.Y), uint16(bounds.Dx()), uint16(bounds.Dy()), 0xffffffff).Reply()
+	if gerr != nil {
+		return nil, nerr.Translate(gerr).Addf("unable to get image from x server")
+	}
+
+	stride := 0
+	for _, f := range setup.PixmapFormats {
+		if f.Depth == screen.RootDepth {
+			pad := int(f.ScanlinePad)
+			stride = (bounds.Dx()*int(f.BitsPerPixel) + pad - 1) / pad * pad / 8
+		}
+	}
+
+	return format.toImage(reply.Data, bounds.Dx(), bounds.Dy(), stride)
+}
+
+// x11PixelFormat returns the layout of the pixels of the root window
+func x11PixelFormat(setup *xproto.SetupInfo, screen xproto.ScreenInfo) (pixelFormat, *nerr.E) {
+	format := pixelFormat{
+		order: binary.LittleEndian,
+	}
+
+	if setup.ImageByteOrder == xproto.ImageOrderMSBFirst {
+		format.order = binary.BigEndian
+	}
+
+	for _, f := range setup.PixmapFormats {
+		if f.Depth == screen.RootDepth {
+			format.bitsPerPixel = int(f.BitsPerPixel)
+		}
+	}
+
+	for _, depth := range screen.AllowedDepths {
+		for _, visual := range depth.Visuals {
+			if visual.VisualId != screen.RootVisual {
+				continue
+			}
+
+			if visual.Class != xproto.VisualClassTrueColor && visual.Class != xproto.VisualClassDirectColor {
+				return format, nerr.Createf("error", "unsupported visual class %d", visual.Class)
+			}
+
+			format.red = visual.RedMask
+			format.green = visual.GreenMask
+			format.blue = visual.BlueMask
+			return format, nil
+		}
+	}
+
+	return format, nerr.Create("unable to find the root window's visual", "error")
+}
+
+// outputBounds returns where output (ie, HDMI-1) is on the screen
+func outputBounds(conn *xgb.Conn, root xproto.Window, output string) (image.Rectangle, *nerr.E) {
+	if err := randr.Init(conn); err != nil {
+		return image.Rectangle{}, nerr.Translate(err).Addf("unable to find output %s", output)
+	}
+
+	resources, err := randr.GetScreenResourcesCurrent(conn, root).Reply()
+	if err != nil {
+		return image.Rectangle{}, nerr.Translate(err).Addf("unable to find output %s", output)
+	}
+
+	var names []string
+	for _, o := range resources.Outputs {
+		info, err := randr.GetOutputInfo(conn, o, resources.ConfigTimestamp).Reply()
+		if err != nil {
+			return image.Rectangle{}, nerr.Translate(err).Addf("unable to find output %s", output)
+		}
+
+		if info.Crtc == 0 {
+			// the output isn't being used
+			continue
+		}
+
+		name := string(info.Name)
+		names = append(names, name)
+
+		if name != output {
+			continue
+		}
+
+		crtc, err := randr.GetCrtcInfo(conn, info.Crtc, resources.ConfigTimestamp).Reply()
+		if err != nil {
+			return image.Rectangle{}, nerr.Translate(err).Addf("unable to find output %s", output)
+		}
+
+		return image.Rect(int(crtc.X), int(crtc.Y), int(crtc.X)+int(crtc.Width), int(crtc.Y)+int(crtc.Height)), nil
+	}
+
+	return image.Rectangle{}, nerr.Createf("invalid", "output %s isn't connected (connected outputs: %s)", output, strings.Join(names, ", "))
+}
@@ -0,0 +1,150 @@
+package screenshot
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"image"
+	"image/color"
+	"io"
+	"io/ioutil"
+	"os/exec"
+
+	"github.com/byuoitav/common/nerr"
+)
+
+const (
+	xwdVersion = 7
+	zPixmap    = 2
+
+	// visual classes
+	staticGray  = 0
+	grayScale   = 1
+	staticColor = 2
+	pseudoColor = 3
+	trueColor   = 4
+	directColor = 5
+)
+
+// xwdHeader is the header of an xwd dump. every field is a big endian uint32
+type xwdHeader struct {
+	HeaderSize      uint32
+	FileVersion     uint32
+	PixmapFormat    uint32
+	PixmapDepth     uint32
+	PixmapWidth     uint32
+	PixmapHeight    uint32
+	XOffset         uint32
+	ByteOrder       uint32
+	BitmapUnit      uint32
+	BitmapBitOrder  uint32
+	BitmapPad       uint32
+	BitsPerPixel    uint32
+	BytesPerLine    uint32
+	VisualClass     uint32
+	RedMask         uint32
+	GreenMask       uint32
+	BlueMask        uint32
+	BitsPerRGB      uint32
+	ColormapEntries uint32
+	NColors         uint32
+	WindowWidth     uint32
+	WindowHeight    uint32
+	WindowX         uint32
+	WindowY         uint32
+	WindowBorder    uint32
+}
+
+// xwdColor is an entry in an xwd dump's colormap
+type xwdColor struct {
+	Pixel uint32
+	Red   uint16
+	Green uint16
+	Blue  uint16
+	Flags uint8
+	Pad   uint8
+}
+
+// captureXWD dumps the screen with xwd. it's only used if the x server can't be reached directly
+func captureXWD(ctx context.Context, display string) (*image.RGBA, *nerr.E) {
+	var stdout, stderr bytes.Buffer
+
+	cmd := exec.CommandContext(ctx, "xwd", "-root", "-silent", "-display", display)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	if err := cmd.Run(); err != nil {
+		if stderr.Len() > 0 {
+			return nil, nerr.Translate(err).Addf("unable to run xwd: %s", stderr.String())
+		}
+
+		return nil, nerr.Translate(err).Addf("unable to run xwd")
+	}
+
+	return DecodeXWD(&stdout)
+}
+
+// DecodeXWD decodes an xwd dump (ie, from xwd -root)
+func DecodeXWD(r io.Reader) (*image.RGBA, *nerr.E) {
+	var header xwdHeader
+	if err := binary.Read(r, binary.BigEndian, &header); err != nil {
+		return nil, nerr.Translate(err).Addf("unable to read xwd header")
+	}
+
+	switch {
+	case header.FileVersion != xwdVersion:
+		return nil, nerr.Createf("error", "unsupported xwd version %d", header.FileVersion)
+	case header.PixmapFormat != zPixmap:
+		return nil, nerr.Createf("error", "unsupported xwd pixmap format %d", header.PixmapFormat)
+	}
+
+	// skip the window name
+	size := uint32(binary.Size(header))
+	if header.HeaderSize < size {
+		return nil, nerr.Createf("error", "invalid xwd header size %d", header.HeaderSize)
+	}
+
+	if _, err := io.CopyN(ioutil.Discard, r, int64(header.HeaderSize-size)); err != nil {
+		return nil, nerr.Translate(err).Addf("unable to read xwd header")
+	}
+
+	colors := make([]xwdColor, header.NColors)
+	if err := binary.Read(r, binary.BigEndian, colors); err != nil {
+		return nil, nerr.Translate(err).Addf("unable to read xwd colormap")
+	}
+
+	format := pixelFormat{
+		bitsPerPixel: int(header.BitsPerPixel),
+		order:        binary.LittleEndian,
+		red:          header.RedMask,
+		green:        header.GreenMask,
+		blue:         header.BlueMask,
+	}
+
+	if header.ByteOrder != 0 {
+		format.order = binary.BigEndian
+	}
+
+	switch header.VisualClass {
+	case trueColor, directColor:
+	case staticGray, grayScale, staticColor, pseudoColor:
+		format.colormap = make(map[uint32]color.RGBA, len(colors))
+		for _, c := range colors {
+			format.colormap[c.Pixel] = color.RGBA{
+				R: uint8(c.Red >> 8),
+				G: uint8(c.Green >> 8),
+				B: uint8(c.Blue >> 8),
+				A: 0xff,
+			}
+		}
+	default:
+		return nil, nerr.Createf("error", "unsupported xwd visual class %d", header.VisualClass)
+	}
+
+	data := make([]byte, header.BytesPerLine*header.PixmapHeight)
+	if _, err := io.ReadFull(r, data); err != nil {
+		return nil, nerr.Translate(err).Addf("unable to read xwd image")
+	}
+
+	return format.toImage(data, int(header.PixmapWidth), int(header.PixmapHeight), int(header.BytesPerLine))
+}
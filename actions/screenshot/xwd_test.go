@@ -0,0 +1,413 @@
+package screenshot
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image/color"
+	"testing"
+)
+
+var (
+	red   = color.RGBA{R: 0xff, A: 0xff}
+	green = color.RGBA{G: 0xff, A: 0xff}
+	blue  = color.RGBA{B: 0xff, A: 0xff}
+	gray  = color.RGBA{R: 0x11, G: 0x22, B: 0x33, A: 0xff}
+)
+
+// xwdImage describes an xwd dump to build for a test
+type xwdImage struct {
+	width, height int
+	bitsPerPixel  int
+	bytesPerLine  int
+	order         binary.ByteOrder
+	visualClass   uint32
+
+	red, green, blue uint32
+	colors           []xwdColor
+
+	// pixels are the raw pixel values, row by row
+	pixels []uint32
+}
+
+// encode builds the xwd dump, the way xwd writes it
+func (x xwdImage) encode(t *testing.T) []byte {
+	name := []byte("test\x00")
+
+	header := xwdHeader{
+		FileVersion:  xwdVersion,
+		PixmapFormat: zPixmap,
+		PixmapDepth:  uint32(x.bitsPerPixel),
+		PixmapWidth:  uint32(x.width),
+		PixmapHeight: uint32(x.height),
+		BitsPerPixel: uint32(x.bitsPerPixel),
+		BytesPerLine: uint32(x.bytesPerLine),
+		VisualClass:  x.visualClass,
+		RedMask:      x.red,
+		GreenMask:    x.green,
+		BlueMask:     x.blue,
+		NColors:      uint32(len(x.colors)),
+		WindowWidth:  uint32(x.width),
+		WindowHeight: uint32(x.height),
+	}
+
+	header.HeaderSize = uint32(binary.Size(header) + len(name))
+	if x.order == binary.BigEndian {
+		header.ByteOrder = 1
+	}
+
+	buf := &bytes.Buffer{}
+	if err := binary.Write(buf, binary.BigEndian, header); err != nil {
+		t.Fatalf("unable to write header: %s", err)
+	}
+
+	buf.Write(name)
+
+	if err := binary.Write(buf, binary.BigEndian, x.colors); err != nil {
+		t.Fatalf("unable to write colormap: %s", err)
+	}
+
+	bytesPerPixel := x.bitsPerPixel / 8
+	for y := 0; y < x.height; y++ {
+		row := make([]byte, x.bytesPerLine)
+
+		for i := 0; i < x.width; i++ {
+			putPixel(row[i*bytesPerPixel:], x.pixels[y*x.width+i], x.bitsPerPixel, x.order)
+		}
+
+		buf.Write(row)
+	}
+
+	return buf.Bytes()
+}
+
+func putPixel(b []byte, p uint32, bitsPerPixel int, order binary.ByteOrder) {
+	switch bitsPerPixel {
+	case 8:
+		b[0] = uint8(p)
+	case 16:
+		order.PutUint16(b, uint16(p))
+	case 24:
+		if order == binary.BigEndian {
+			b[0], b[1], b[2] = uint8(p>>16), uint8(p>>8), uint8(p)
+		} else {
+			b[0], b[1], b[2] = uint8(p), uint8(p>>8), uint8(p>>16)
+		}
+	default:
+		order.PutUint32(b, p)
+	}
+}
+
+func TestDecodeXWD(t *testing.T) {
+	tests := []struct {
+		name  string
+		xwd   xwdImage
+		width int
+		want  []color.RGBA
+	}{
+		{
+			name: "8 bit pseudocolor",
+			xwd: xwdImage{
+				width: 3, height: 1, bitsPerPixel: 8, bytesPerLine: 4,
+				order:       binary.LittleEndian,
+				visualClass: pseudoColor,
+				colors: []xwdColor{
+					{Pixel: 0, Red: 0xffff},
+					{Pixel: 1, Green: 0xffff},
+					{Pixel: 7, Red: 0x1100, Green: 0x2200, Blue: 0x3300},
+				},
+				pixels: []uint32{0, 1, 7},
+			},
+			want: []color.RGBA{red, green, gray},
+		},
+		{
+			name: "16 bit 565 little endian",
+			xwd: xwdImage{
+				width: 2, height: 2, bitsPerPixel: 16, bytesPerLine: 4,
+				order:       binary.LittleEndian,
+				visualClass: trueColor,
+				red:         0xf800, green: 0x07e0, blue: 0x001f,
+				pixels: []uint32{0xf800, 0x07e0, 0x001f, 0x8410},
+			},
+			want: []color.RGBA{red, green, blue, {R: 131, G: 129, B: 131, A: 0xff}},
+		},
+		{
+			name: "16 bit 565 big endian",
+			xwd: xwdImage{
+				width: 2, height: 2, bitsPerPixel: 16, bytesPerLine: 4,
+				order:       binary.BigEndian,
+				visualClass: trueColor,
+				red:         0xf800, green: 0x07e0, blue: 0x001f,
+				pixels: []uint32{0xf800, 0x07e0, 0x001f, 0x8410},
+			},
+			want: []color.RGBA{red, green, blue, {R: 131, G: 129, B: 131, A: 0xff}},
+		},
+		{
+			name: "24 bit little endian",
+			xwd: xwdImage{
+				width: 2, height: 2, bitsPerPixel: 24, bytesPerLine: 6,
+				order:       binary.LittleEndian,
+				visualClass: trueColor,
+				red:         0xff0000, green: 0x00ff00, blue: 0x0000ff,
+				pixels: []uint32{0xff0000, 0x00ff00, 0x0000ff, 0x112233},
+			},
+			want: []color.RGBA{red, green, blue, gray},
+		},
+		{
+			name: "24 bit big endian",
+			xwd: xwdImage{
+				width: 2, height: 2, bitsPerPixel: 24, bytesPerLine: 6,
+				order:       binary.BigEndian,
+				visualClass: trueColor,
+				red:         0xff0000, green: 0x00ff00, blue: 0x0000ff,
+				pixels: []uint32{0xff0000, 0x00ff00, 0x0000ff, 0x112233},
+			},
+			want: []color.RGBA{red, green, blue, gray},
+		},
+		{
+			name: "32 bit little endian",
+			xwd: xwdImage{
+				width: 2, height: 2, bitsPerPixel: 32, bytesPerLine: 8,
+				order:       binary.LittleEndian,
+				visualClass: trueColor,
+				red:         0xff0000, green: 0x00ff00, blue: 0x0000ff,
+				pixels: []uint32{0xff0000, 0x00ff00, 0x0000ff, 0xff112233},
+			},
+			want: []color.RGBA{red, green, blue, gray},
+		},
+		{
+			name: "32 bit big endian",
+			xwd: xwdImage{
+				width: 2, height: 2, bitsPerPixel: 32, bytesPerLine: 8,
+				order:       binary.BigEndian,
+				visualClass: trueColor,
+				red:         0xff0000, green: 0x00ff00, blue: 0x0000ff,
+				pixels: []uint32{0xff0000, 0x00ff00, 0x0000ff, 0xff112233},
+			},
+			want: []color.RGBA{red, green, blue, gray},
+		},
+		{
+			name: "32 bit bgr",
+			xwd: xwdImage{
+				width: 2, height: 1, bitsPerPixel: 32, bytesPerLine: 8,
+				order:       binary.LittleEndian,
+				visualClass: directColor,
+				red:         0x0000ff, green: 0x00ff00, blue: 0xff0000,
+				pixels: []uint32{0x0000ff, 0x332211},
+			},
+			want: []color.RGBA{red, gray},
+		},
+		{
+			name: "padded stride",
+			xwd: xwdImage{
+				width: 3, height: 2, bitsPerPixel: 24, bytesPerLine: 12,
+				order:       binary.LittleEndian,
+				visualClass: trueColor,
+				red:         0xff0000, green: 0x00ff00, blue: 0x0000ff,
+				pixels: []uint32{
+					0xff0000, 0x00ff00, 0x0000ff,
+					0x112233, 0xff0000, 0x00ff00,
+				},
+			},
+			want: []color.RGBA{red, green, blue, gray, red, green},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			img, err := DecodeXWD(bytes.NewReader(tt.xwd.encode(t)))
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err.Error())
+			}
+
+			if img.Bounds().Dx() != tt.xwd.width || img.Bounds().Dy() != tt.xwd.height {
+				t.Fatalf("got a %dx%d image, want %dx%d", img.Bounds().Dx(), img.Bounds().Dy(), tt.xwd.width, tt.xwd.height)
+			}
+
+			for i, want := range tt.want {
+				x, y := i%tt.xwd.width, i/tt.xwd.width
+
+				if got := img.RGBAAt(x, y); got != want {
+					t.Errorf("pixel (%d, %d) = %v, want %v", x, y, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestDecodeXWDErrors(t *testing.T) {
+	valid := xwdImage{
+		width: 2, height: 2, bitsPerPixel: 32, bytesPerLine: 8,
+		order:       binary.LittleEndian,
+		visualClass: trueColor,
+		red:         0xff0000, green: 0x00ff00, blue: 0x0000ff,
+		pixels: []uint32{0, 0, 0, 0},
+	}
+
+	tests := []struct {
+		name   string
+		modify func(b []byte) []byte
+	}{
+		{
+			name: "empty",
+			modify: func(b []byte) []byte {
+				return nil
+			},
+		},
+		{
+			name: "unsupported version",
+			modify: func(b []byte) []byte {
+				binary.BigEndian.PutUint32(b[4:], 6)
+				return b
+			},
+		},
+		{
+			name: "unsupported pixmap format",
+			modify: func(b []byte) []byte {
+				binary.BigEndian.PutUint32(b[8:], 1)
+				return b
+			},
+		},
+		{
+			name: "header size too small",
+			modify: func(b []byte) []byte {
+				binary.BigEndian.PutUint32(b[0:], 4)
+				return b
+			},
+		},
+		{
+			name: "unsupported visual class",
+			modify: func(b []byte) []byte {
+				binary.BigEndian.PutUint32(b[52:], 9)
+				return b
+			},
+		},
+		{
+			name: "truncated image",
+			modify: func(b []byte) []byte {
+				return b[:len(b)-1]
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := DecodeXWD(bytes.NewReader(tt.modify(valid.encode(t)))); err == nil {
+				t.Fatalf("expected an error")
+			}
+		})
+	}
+}
+
+func TestToImage(t *testing.T) {
+	tests := []struct {
+		name   string
+		format pixelFormat
+		data   []byte
+		width  int
+		height int
+		stride int
+		want   []color.RGBA
+		err    bool
+	}{
+		{
+			name:   "24 bit big endian",
+			format: pixelFormat{bitsPerPixel: 24, order: binary.BigEndian, red: 0xff0000, green: 0x00ff00, blue: 0x0000ff},
+			data:   []byte{0x11, 0x22, 0x33, 0xff, 0x00, 0x00},
+			width:  2, height: 1, stride: 6,
+			want: []color.RGBA{gray, red},
+		},
+		{
+			name:   "padding is skipped",
+			format: pixelFormat{bitsPerPixel: 16, order: binary.LittleEndian, red: 0xf800, green: 0x07e0, blue: 0x001f},
+			data:   []byte{0x00, 0xf8, 0xaa, 0xaa, 0x1f, 0x00, 0xaa, 0xaa},
+			width:  1, height: 2, stride: 4,
+			want: []color.RGBA{red, blue},
+		},
+		{
+			name:   "the last row doesn't need padding",
+			format: pixelFormat{bitsPerPixel: 8, colormap: map[uint32]color.RGBA{1: red, 2: green}},
+			data:   []byte{0x01, 0x00, 0x00, 0x00, 0x02},
+			width:  1, height: 2, stride: 4,
+			want: []color.RGBA{red, green},
+		},
+		{
+			name:   "unknown colormap entry",
+			format: pixelFormat{bitsPerPixel: 8, colormap: map[uint32]color.RGBA{}},
+			data:   []byte{0x05},
+			width:  1, height: 1, stride: 1,
+			want: []color.RGBA{{}},
+		},
+		{
+			name:   "unsupported bits per pixel",
+			format: pixelFormat{bitsPerPixel: 12, order: binary.LittleEndian},
+			data:   make([]byte, 16),
+			width:  2, height: 2, stride: 4,
+			err: true,
+		},
+		{
+			name:   "stride is shorter than a row",
+			format: pixelFormat{bitsPerPixel: 32, order: binary.LittleEndian},
+			data:   make([]byte, 16),
+			width:  2, height: 2, stride: 4,
+			err: true,
+		},
+		{
+			name:   "data is too short",
+			format: pixelFormat{bitsPerPixel: 32, order: binary.LittleEndian},
+			data:   make([]byte, 15),
+			width:  2, height: 2, stride: 8,
+			err: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			img, err := tt.format.toImage(tt.data, tt.width, tt.height, tt.stride)
+			switch {
+			case tt.err && err == nil:
+				t.Fatalf("expected an error")
+			case tt.err:
+				return
+			case err != nil:
+				t.Fatalf("unexpected error: %s", err.Error())
+			}
+
+			for i, want := range tt.want {
+				x, y := i%tt.width, i/tt.width
+
+				if got := img.RGBAAt(x, y); got != want {
+					t.Errorf("pixel (%d, %d) = %v, want %v", x, y, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestChannel(t *testing.T) {
+	tests := []struct {
+		name string
+		p    uint32
+		mask uint32
+		want uint8
+	}{
+		{"no mask", 0xffffffff, 0, 0},
+		{"8 bit low", 0x123456, 0x0000ff, 0x56},
+		{"8 bit middle", 0x123456, 0x00ff00, 0x34},
+		{"8 bit high", 0x123456, 0xff0000, 0x12},
+		{"5 bit max", 0xf800, 0xf800, 0xff},
+		{"5 bit min", 0x07ff, 0xf800, 0x00},
+		{"5 bit half", 0x8000, 0xf800, 131},
+		{"6 bit max", 0x07e0, 0x07e0, 0xff},
+		{"6 bit half", 0x0400, 0x07e0, 129},
+		{"other bits are ignored", 0xff00ff, 0x00ff00, 0x00},
+		{"10 bit", 0x3ff << 20, 0x3ff << 20, 0xff},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := channel(tt.p, tt.mask); got != tt.want {
+				t.Errorf("channel(%#x, %#x) = %d, want %d", tt.p, tt.mask, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,52 @@
+package then
+
+import (
+	"context"
+	"time"
+
+	"github.com/byuoitav/common/nerr"
+	"github.com/byuoitav/common/v2/events"
+	"github.com/byuoitav/device-monitoring/actions/reboot"
+	"github.com/byuoitav/device-monitoring/localsystem"
+	"github.com/byuoitav/device-monitoring/messenger"
+	"go.uber.org/zap"
+)
+
+// deviceBoot sends a device-boot event if the device has rebooted since this service last ran,
+// then keeps track of when the device was last running until ctx is cancelled. it should run once at startup.
+func deviceBoot(ctx context.Context, with []byte, log *zap.SugaredLogger) *nerr.E {
+	systemID, err := localsystem.SystemID()
+	if err != nil {
+		return err.Addf("unable to report boot")
+	}
+
+	deviceInfo := events.GenerateBasicDeviceInfo(systemID)
+
+	checkCtx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	boot, rebooted, err := reboot.CheckBoot(checkCtx)
+	cancel()
+
+	switch {
+	case err != nil:
+		log.Warnf("unable to check why the device booted: %s", err.Error())
+	case rebooted:
+		log.Infof("Device booted at %s (reason: %s)", boot.BootedAt.Format(time.RFC3339), boot.Reason)
+
+		messenger.Get().SendEvent(events.Event{
+			GeneratingSystem: systemID,
+			Timestamp:        time.Now(),
+			EventTags: []string{
+				events.DetailState,
+				events.AutoGenerated,
+			},
+			TargetDevice: deviceInfo,
+			AffectedRoom: deviceInfo.BasicRoomInfo,
+			Key:          "device-boot",
+			Value:        boot.Reason,
+			Data:         boot,
+		})
+	}
+
+	reboot.Heartbeat(ctx)
+	return nil
+}
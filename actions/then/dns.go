@@ -0,0 +1,154 @@
+package then
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/byuoitav/common/nerr"
+	"github.com/byuoitav/common/v2/events"
+	"github.com/byuoitav/device-monitoring/actions/dns"
+	"github.com/byuoitav/device-monitoring/localsystem"
+	"github.com/byuoitav/device-monitoring/messenger"
+	"github.com/byuoitav/device-monitoring/metrics"
+	"go.uber.org/zap"
+)
+
+func dnsCheck(ctx context.Context, with []byte, log *zap.SugaredLogger) *nerr.E {
+	var config dns.CheckConfig
+	if len(with) > 0 {
+		if err := json.Unmarshal(with, &config); err != nil {
+			return nerr.Translate(err).Addf("unable to check dns")
+		}
+	}
+
+	systemID, err := localsystem.SystemID()
+	if err != nil {
+		return err.Addf("unable to check dns")
+	}
+
+	roomID, err := localsystem.RoomID()
+	if err != nil {
+		return err.Addf("unable to check dns")
+	}
+
+	deviceInfo := events.GenerateBasicDeviceInfo(systemID)
+
+	// timeout if this takes longer than 30 seconds
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+
+	check, err := dns.RunCheck(ctx, roomID, config)
+	if err != nil {
+		return err.Addf("unable to check dns")
+	}
+
+	event := events.Event{
+		GeneratingSystem: systemID,
+		Timestamp:        time.Now(),
+		EventTags: []string{
+			events.DetailState,
+			events.AutoGenerated,
+		},
+		TargetDevice: deviceInfo,
+		AffectedRoom: deviceInfo.BasicRoomInfo,
+	}
+
+	tmp := event
+	tmp.Key = "dns-healthy"
+	tmp.Value = fmt.Sprintf("%v", check.Healthy)
+	tmp.Data = check
+	messenger.Get().SendEvent(tmp)
+
+	// a name/device is failing if it fails against any nameserver
+	names := make(map[string][]dns.NameResult)
+	for _, name := range check.Names {
+		metrics.DNSLookup(name.Name, name.Nameserver, name.Duration(), name.Matches)
+		names[name.Name] = append(names[name.Name], name)
+
+		if !name.Matches {
+			log.Warnf("%s did not resolve as expected with %s: %v %s", name.Name, name.Nameserver, name.Addresses, name.Error)
+		}
+	}
+
+	for name, results := range names {
+		failed := false
+		for _, res := range results {
+			if !res.Matches {
+				failed = true
+			}
+		}
+
+		tmp = event
+		tmp.Key = "dns-lookup-failed"
+		tmp.Value = name
+		tmp.Data = results
+
+		dnsAlert(tmp, name, failed, log)
+	}
+
+	// report devices that resolve to somewhere other than their address in the database
+	devices := make(map[string][]dns.DeviceResult)
+	for _, device := range check.Devices {
+		devices[device.Device] = append(devices[device.Device], device)
+
+		if !device.Matches {
+			log.Warnf("%s resolved to %v with %s, but its address is %s %s", device.Hostname, device.Resolved, device.Nameserver, device.Address, device.Error)
+		}
+	}
+
+	for id, results := range devices {
+		var resolved []string
+		mismatched := false
+
+		for _, res := range results {
+			if !res.Matches {
+				mismatched = true
+				resolved = append(resolved, res.Resolved...)
+			}
+		}
+
+		tmp = event
+		tmp.TargetDevice = events.GenerateBasicDeviceInfo(id)
+		tmp.Key = "dns-address-mismatch"
+		tmp.Value = fmt.Sprintf("%v", resolved)
+		tmp.Data = results
+
+		dnsAlert(tmp, id, mismatched, log)
+	}
+
+	return nil
+}
+
+// whether each name/device was failing the last time dnsCheck ran, so that alerts are only sent when it changes
+var (
+	dnsFailing   = make(map[string]bool)
+	dnsFailingMu sync.Mutex
+)
+
+// dnsAlert raises event as an alert when the name/device starts failing, and clears it when it stops failing
+func dnsAlert(event events.Event, name string, failing bool, log *zap.SugaredLogger) {
+	id := event.Key + "-" + name
+
+	dnsFailingMu.Lock()
+	prev, checked := dnsFailing[id]
+	dnsFailing[id] = failing
+	dnsFailingMu.Unlock()
+
+	if prev == failing && (checked || !failing) {
+		return
+	}
+
+	event.AddToTags("alert")
+
+	if failing {
+		event.AddToTags("alert-raise")
+	} else {
+		event.AddToTags("alert-clear")
+		log.Infof("%s is resolving as expected again", name)
+	}
+
+	messenger.Get().SendEvent(event)
+}
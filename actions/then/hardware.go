@@ -4,32 +4,71 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"sort"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/byuoitav/common/nerr"
 	"github.com/byuoitav/common/v2/events"
+	"github.com/byuoitav/device-monitoring/actions/alerts"
 	"github.com/byuoitav/device-monitoring/actions/hardwareinfo"
 	"github.com/byuoitav/device-monitoring/localsystem"
 	"github.com/byuoitav/device-monitoring/messenger"
-	"github.com/shirou/gopsutil/disk"
-	"github.com/shirou/gopsutil/mem"
+	"github.com/byuoitav/device-monitoring/metrics"
 	"go.uber.org/zap"
 )
 
+type hardwareInfoConfig struct {
+	History hardwareinfo.HistoryConfig `json:"history"`
+	Disk    localsystem.DiskConfig     `json:"disk"`
+	USleep  localsystem.USleepConfig   `json:"u-sleep"`
+}
+
+var (
+	// each action keeps its own previous disk sample, so that they don't consume each other's remounts
+	hardwareInfoDisks  localsystem.DiskTracker
+	hardwareAlertDisks localsystem.DiskTracker
+)
+
 func hardwareInfo(ctx context.Context, with []byte, log *zap.SugaredLogger) *nerr.E {
+	var config hardwareInfoConfig
+	if len(with) > 0 {
+		if err := json.Unmarshal(with, &config); err != nil {
+			return nerr.Translate(err).Addf("unable to get hardware info")
+		}
+	}
+
 	systemID, err := localsystem.SystemID()
 	if err != nil {
 		return err.Addf("unable to get hardware info")
 	}
 
 	deviceInfo := events.GenerateBasicDeviceInfo(systemID)
+	localsystem.SetDiskConfig(config.Disk)
 
-	info, err := hardwareinfo.PiInfo()
+	if err := localsystem.SetUSleepConfig(config.USleep); err != nil {
+		return err.Addf("unable to get hardware info")
+	}
+
+	info, err := hardwareinfo.PiInfo(ctx)
 	if err != nil {
 		return err.Addf("unable to get hardware info")
 	}
 
+	hardwareInfoDisks.Update(info.Disk)
+
+	// keep a local history of the metrics
+	history := hardwareinfo.History()
+	if err := history.Configure(config.History); err != nil {
+		log.Warnf("unable to configure hardware history: %s", err.Error())
+	}
+
+	history.Add(hardwareinfo.Sample{
+		Timestamp: time.Now(),
+		Values:    info.Values(),
+	})
+
 	// build base event
 	event := events.Event{
 		GeneratingSystem: systemID,
@@ -47,52 +86,80 @@ func hardwareInfo(ctx context.Context, with []byte, log *zap.SugaredLogger) *ner
 	messenger.Get().SendEvent(event)
 	event.Data = nil
 
-	if usage, ok := info.CPU["usage"].(map[string]float64); ok {
-		if avg, ok := usage["avg"]; ok {
+	// let people know which sections couldn't be collected; everything else is still sent
+	if len(info.Errors) > 0 {
+		var sections []string
+		for section := range info.Errors {
+			sections = append(sections, section)
+		}
+
+		sort.Strings(sections)
+
+		tmp := event
+		tmp.AddToTags(events.DetailState)
+		tmp.Key = "hardware-info-errors"
+		tmp.Value = strings.Join(sections, ", ")
+		tmp.Data = info.Errors
+		messenger.Get().SendEvent(tmp)
+	}
+
+	if info.CPU != nil {
+		for cpu, percent := range info.CPU.Usage {
+			metrics.CPUUsage(cpu, percent)
+		}
+
+		if avg, ok := info.CPU.Usage["avg"]; ok {
 			tmp := event
 			tmp.AddToTags(events.DetailState)
 			tmp.Key = "cpu-usage-percent"
 			tmp.Value = fmt.Sprintf("%v", avg)
 			messenger.Get().SendEvent(tmp)
 		}
-	}
 
-	// send info about cpu load averages
-	if loadAvg1min, ok := info.CPU["avg1min"].(float64); ok {
+		// send info about cpu load averages
+		metrics.LoadAverage("1m", info.CPU.LoadAvg1Min)
+		metrics.LoadAverage("5m", info.CPU.LoadAvg5Min)
+		metrics.LoadAverage("15m", info.CPU.LoadAvg15Min)
+
 		tmp := event
 		tmp.AddToTags(events.DetailState)
 		tmp.Key = "cpu-load-average-1-min"
-		tmp.Value = fmt.Sprintf("%v", loadAvg1min)
+		tmp.Value = fmt.Sprintf("%v", info.CPU.LoadAvg1Min)
 		messenger.Get().SendEvent(tmp)
-	}
 
-	if loadAvg5min, ok := info.CPU["avg5min"].(float64); ok {
-		tmp := event
+		tmp = event
 		tmp.AddToTags(events.DetailState)
 		tmp.Key = "cpu-load-average-5-min"
-		tmp.Value = fmt.Sprintf("%v", loadAvg5min)
+		tmp.Value = fmt.Sprintf("%v", info.CPU.LoadAvg5Min)
 		messenger.Get().SendEvent(tmp)
 	}
 
 	// send info about memory usage
-	if vMem, ok := info.Memory["virtual"].(*mem.VirtualMemoryStat); ok {
+	if info.Memory != nil && info.Memory.Virtual != nil {
+		metrics.MemoryUsage("virtual", info.Memory.Virtual.UsedPercent)
+
 		tmp := event
 		tmp.AddToTags(events.DetailState)
 		tmp.Key = "v-mem-used-percent"
-		tmp.Value = fmt.Sprintf("%v", vMem.UsedPercent)
+		tmp.Value = fmt.Sprintf("%v", info.Memory.Virtual.UsedPercent)
 		messenger.Get().SendEvent(tmp)
 	}
 
 	// send info about swap usage
-	if sMem, ok := info.Memory["swap"].(*mem.SwapMemoryStat); ok {
-		event.Key = "s-mem-used-percent"
-		event.Value = fmt.Sprintf("%v", sMem.UsedPercent)
-		messenger.Get().SendEvent(event)
+	if info.Memory != nil && info.Memory.Swap != nil {
+		metrics.MemoryUsage("swap", info.Memory.Swap.UsedPercent)
+
+		tmp := event
+		tmp.Key = "s-mem-used-percent"
+		tmp.Value = fmt.Sprintf("%v", info.Memory.Swap.UsedPercent)
+		messenger.Get().SendEvent(tmp)
 	}
 
 	// send info about chip temp
-	if temps, ok := info.Host["temperature"].(map[string]float64); ok {
-		for chip, temp := range temps {
+	if info.Host != nil {
+		for chip, temp := range info.Host.Temperature {
+			metrics.Temperature(chip, temp)
+
 			tmp := event
 			tmp.AddToTags(events.DetailState)
 			tmp.Key = fmt.Sprintf("%s-temp", chip)
@@ -101,49 +168,161 @@ func hardwareInfo(ctx context.Context, with []byte, log *zap.SugaredLogger) *ner
 		}
 	}
 
-	// send info about # of writes
-	if counters, ok := info.Disk["io-counters"]; ok {
-		if disks, ok := counters.(map[string]disk.IOCountersStat); ok {
-			for disk, stats := range disks {
+	if info.Disk != nil {
+		// send info about # of writes
+		for disk, stats := range info.Disk.IOCounters {
+			metrics.DiskWrites(disk, stats.WriteCount)
+
+			tmp := event
+			tmp.AddToTags(events.DetailState)
+			tmp.Key = fmt.Sprintf("writes-to-%s", disk)
+			tmp.Value = fmt.Sprintf("%v", stats.WriteCount)
+			messenger.Get().SendEvent(tmp)
+		}
+
+		// send info about total disk usage
+		if info.Disk.Usage != nil {
+			metrics.DiskUsage(info.Disk.Usage.Path, info.Disk.Usage.UsedPercent)
+
+			tmp := event
+			tmp.AddToTags(events.DetailState)
+			tmp.Key = "disk-used-percent"
+			tmp.Value = fmt.Sprintf("%v", info.Disk.Usage.UsedPercent)
+			messenger.Get().SendEvent(tmp)
+		}
+
+		for _, fs := range info.Disk.Filesystems {
+			name := hardwareinfo.MountName(fs.MountPoint)
+
+			if fs.Usage != nil {
+				metrics.DiskUsage(fs.MountPoint, fs.Usage.UsedPercent)
+
 				tmp := event
 				tmp.AddToTags(events.DetailState)
-				tmp.Key = fmt.Sprintf("writes-to-%s", disk)
-				tmp.Value = fmt.Sprintf("%v", stats.WriteCount)
+				tmp.Key = fmt.Sprintf("%s-inodes-used-percent", name)
+				tmp.Value = fmt.Sprintf("%v", fs.Usage.InodesUsedPercent)
 				messenger.Get().SendEvent(tmp)
 			}
-		}
-	}
 
-	// send info about total disk usage
-	if usage, ok := info.Disk["usage"].(*disk.UsageStat); ok {
-		tmp := event
-		tmp.AddToTags(events.DetailState)
-		tmp.Key = "disk-used-percent"
-		tmp.Value = fmt.Sprintf("%v", usage.UsedPercent)
-		messenger.Get().SendEvent(tmp)
+			tmp := event
+			tmp.AddToTags(events.DetailState)
+			tmp.Key = fmt.Sprintf("%s-read-only", name)
+			tmp.Value = fmt.Sprintf("%v", fs.ReadOnly)
+			messenger.Get().SendEvent(tmp)
+
+			if fs.ErrorCount != nil {
+				tmp := event
+				tmp.AddToTags(events.DetailState)
+				tmp.Key = fmt.Sprintf("%s-fs-errors", name)
+				tmp.Value = fmt.Sprintf("%v", *fs.ErrorCount)
+				messenger.Get().SendEvent(tmp)
+			}
+
+			// a filesystem suddenly going read-only usually means the sd card is failing
+			if fs.RemountedReadOnly {
+				tmp := event
+				tmp.AddToTags(events.DetailState, events.AutoGenerated, "alert")
+				tmp.Key = "filesystem-remounted-read-only"
+				tmp.Value = fs.MountPoint
+				tmp.Data = fs
+				messenger.Get().SendEvent(tmp)
+			}
+		}
 	}
 
 	// send info about avg # of processes in uninterruptible sleep
-	if avg, ok := info.Procs["avg-procs-u-sleep"]; ok {
+	if info.Procs != nil {
 		tmp := event
 		tmp.AddToTags(events.DetailState)
 		tmp.Key = "avg-procs-u-sleep"
-		tmp.Value = fmt.Sprintf("%v", avg)
+		tmp.Value = fmt.Sprintf("%v", info.Procs.AvgInUSleep)
 		messenger.Get().SendEvent(tmp)
+
+		for window, avg := range info.Procs.AvgsInUSleep {
+			metrics.ProcsInUSleep(window, avg)
+
+			tmp = event
+			tmp.AddToTags(events.DetailState)
+			tmp.Key = fmt.Sprintf("avg-procs-u-sleep-%s", window)
+			tmp.Value = fmt.Sprintf("%v", avg)
+			messenger.Get().SendEvent(tmp)
+		}
+
+		// send the processes that have been blocked the longest
+		if len(info.Procs.LongestBlocked) > 0 {
+			var names []string
+			for _, p := range info.Procs.LongestBlocked {
+				names = append(names, fmt.Sprintf("%s (%s)", p.Name, p.BlockedFor))
+			}
+
+			tmp = event
+			tmp.AddToTags(events.DetailState)
+			tmp.Key = "longest-blocked-procs"
+			tmp.Value = strings.Join(names, ", ")
+			tmp.Data = info.Procs.LongestBlocked
+			messenger.Get().SendEvent(tmp)
+		}
 	}
 
 	// send info about docker containers running -- I get it, it's not hardware but... where else is it going to go?
-	if containers, ok := info.Docker["docker-containers"]; ok {
+	if info.Docker != nil {
+		metrics.DockerContainers(info.Docker.RunningContainers)
+
 		tmp := event
 		tmp.AddToTags(events.DetailState)
 		tmp.Key = "docker-containers"
-		tmp.Value = fmt.Sprintf("%v", containers)
+		tmp.Value = fmt.Sprintf("%v", info.Docker.RunningContainers)
 		messenger.Get().SendEvent(tmp)
+
+		sendContainers(event, info.Docker.Containers)
+	}
+
+	// send info about the pi's firmware reported health
+	if info.Pi != nil {
+		sendPiHealth(event, *info.Pi)
 	}
 
 	return nil
 }
 
+func sendPiHealth(event events.Event, pi localsystem.PiHealth) {
+	send := func(key string, value interface{}) {
+		tmp := event
+		tmp.AddToTags(events.DetailState)
+		tmp.Key = key
+		tmp.Value = fmt.Sprintf("%v", value)
+		messenger.Get().SendEvent(tmp)
+	}
+
+	if pi.Throttled != nil {
+		send("throttled-state", pi.Throttled.Raw)
+		send("under-voltage", pi.Throttled.UnderVoltage)
+		send("under-voltage-occurred", pi.Throttled.UnderVoltageOccurred)
+		send("cpu-throttled", pi.Throttled.Throttled)
+		send("cpu-throttled-occurred", pi.Throttled.ThrottledOccurred)
+		send("frequency-capped", pi.Throttled.FrequencyCapped)
+		send("soft-temp-limit", pi.Throttled.SoftTempLimit)
+	}
+
+	for clock, mhz := range pi.ClocksMHz {
+		send(fmt.Sprintf("%s-clock-mhz", clock), mhz)
+	}
+
+	if pi.CoreVolts != nil {
+		send("core-volts", *pi.CoreVolts)
+	}
+
+	for _, storage := range pi.Storage {
+		if storage.LifeTimeUsed != nil {
+			send(fmt.Sprintf("%s-life-time-used-percent", storage.Device), *storage.LifeTimeUsed)
+		}
+
+		if len(storage.PreEOL) > 0 {
+			send(fmt.Sprintf("%s-pre-eol", storage.Device), storage.PreEOL)
+		}
+	}
+}
+
 func deviceHardwareInfo(ctx context.Context, with []byte, log *zap.SugaredLogger) *nerr.E {
 	systemID, err := localsystem.SystemID()
 	if err != nil {
@@ -300,172 +479,168 @@ func deviceHardwareInfo(ctx context.Context, with []byte, log *zap.SugaredLogger
 	return nil
 }
 
-type tempLimits struct {
-	CriticalThreshold float64 `json:"critical-threshold"`
-	WarningThreshold  float64 `json:"warning-threshold"`
+// hardwareAlerter remembers the alerts of one hardware-alerts action config
+type hardwareAlerter struct {
+	engine *alerts.Engine
+
+	// sections are the metrics each section of the hardware info had the last time it was collected
+	sections map[string]map[string]float64
+	mu       sync.Mutex
 }
 
-func liveTemperatureCheck1(ctx context.Context, with []byte, log *zap.SugaredLogger) *nerr.E {
+var (
+	// hardwareAlerters are keyed by the action's config, so that actions with different rules don't share state
+	hardwareAlerters   = make(map[string]*hardwareAlerter)
+	hardwareAlertersMu sync.Mutex
+)
+
+func hardwareAlertCheck(ctx context.Context, with []byte, log *zap.SugaredLogger) *nerr.E {
+	var rules []alerts.Rule
+	if err := json.Unmarshal(with, &rules); err != nil {
+		return nerr.Translate(err).Addf("unable to check hardware alerts")
+	}
+
 	systemID, err := localsystem.SystemID()
 	if err != nil {
-		return err.Addf("unable to get hardware info")
+		return err.Addf("unable to check hardware alerts")
 	}
 
 	deviceInfo := events.GenerateBasicDeviceInfo(systemID)
 
-	var info hardwareinfo.HardwareInfo
-
-	info.Host, err = localsystem.HostInfo()
+	info, err := hardwareinfo.PiInfo(ctx)
 	if err != nil {
-		return err.Addf("failed to get hardware info")
+		return err.Addf("unable to check hardware alerts")
 	}
 
-	var limits tempLimits
-	er := json.Unmarshal(with, &limits)
-	if er != nil {
-		return nerr.Translate(er)
+	hardwareAlertDisks.Update(info.Disk)
+
+	hardwareAlertersMu.Lock()
+	alerter, ok := hardwareAlerters[string(with)]
+	if !ok {
+		alerter = &hardwareAlerter{
+			engine:   alerts.NewEngine(),
+			sections: make(map[string]map[string]float64),
+		}
+
+		hardwareAlerters[string(with)] = alerter
 	}
+	hardwareAlertersMu.Unlock()
 
-	// build base event
-	event := events.Event{
-		GeneratingSystem: systemID,
-		Timestamp:        time.Now(),
-		EventTags: []string{
-			events.HardwareInfo,
-		},
-		TargetDevice: deviceInfo,
-		AffectedRoom: deviceInfo.BasicRoomInfo,
+	alerter.mu.Lock()
+	defer alerter.mu.Unlock()
+
+	// the metrics of a section that failed to be collected keep their state until it's collected again
+	sections := info.SectionValues()
+	unknown := make(map[string]bool)
+
+	for section := range info.Errors {
+		for metric := range alerter.sections[section] {
+			unknown[metric] = true
+		}
+
+		sections[section] = alerter.sections[section]
 	}
 
-	// send info about chip temp
-	if temps, ok := info.Host["temperature"].(map[string]float64); ok {
-		for chip, temp := range temps {
-			if temp > limits.WarningThreshold {
-				if temp > limits.CriticalThreshold {
-					event.AddToTags(events.DetailState)
-					event.Key = "temp-critical"
-					event.Value = fmt.Sprintf("%v", temp)
-					event.Data = chip
-					messenger.Get().SendEvent(event)
-				} else {
-					event.AddToTags(events.DetailState)
-					event.Key = "temp-warning"
-					event.Value = fmt.Sprintf("%v", temp)
-					event.Data = chip
-					messenger.Get().SendEvent(event)
-				}
-			}
+	alerter.sections = sections
+
+	changes, err := alerter.engine.Evaluate(rules, info.Values(), unknown, time.Now())
+	if err != nil {
+		return err.Addf("unable to check hardware alerts")
+	}
+
+	for _, alert := range changes {
+		event := events.Event{
+			GeneratingSystem: systemID,
+			Timestamp:        alert.Timestamp,
+			EventTags: []string{
+				events.HardwareInfo,
+				events.DetailState,
+				events.AutoGenerated,
+				"alert",
+			},
+			TargetDevice: deviceInfo,
+			AffectedRoom: deviceInfo.BasicRoomInfo,
+			Key:          fmt.Sprintf("%s-%s-alert", alert.Rule, alert.Metric),
+			Value:        alert.Level.String(),
+			Data:         alert,
 		}
+
+		if alert.Cleared() {
+			event.AddToTags("alert-clear")
+			log.Infof("Cleared alert %s on %s (value: %v)", alert.Rule, alert.Metric, alert.Value)
+		} else {
+			event.AddToTags("alert-raise")
+			log.Infof("Raised %s alert %s on %s: %s", alert.Level, alert.Rule, alert.Metric, alert.Reason)
+		}
+
+		messenger.Get().SendEvent(event)
 	}
 
 	return nil
 }
 
-func liveTemperatureCheck(ctx context.Context, with []byte, log *zap.SugaredLogger) *nerr.E {
-	//checks every 5 seconds to see if the temp is high
-	ticker1 := time.NewTicker(5 * time.Second)
-	//gives us the temp every 5 minutes
-	ticker2 := time.NewTicker(5 * time.Minute)
+// containerTracker remembers the state of each container the last time the hardware-info action ran
+type containerTracker struct {
+	last map[string]localsystem.Container
+	mu   sync.Mutex
+}
 
-	systemID, err := localsystem.SystemID()
-	if err != nil {
-		return err.Addf("unable to get hardware info")
-	}
+var hardwareInfoContainers containerTracker
 
-	deviceInfo := events.GenerateBasicDeviceInfo(systemID)
-	previousTemps := make(map[string]float64)
+// sendContainers sends the state of each docker container, and alerts when one exits or becomes unhealthy
+func sendContainers(event events.Event, containers []localsystem.Container) {
+	hardwareInfoContainers.mu.Lock()
+	defer hardwareInfoContainers.mu.Unlock()
 
-	var info hardwareinfo.HardwareInfo
+	last := hardwareInfoContainers.last
+	hardwareInfoContainers.last = make(map[string]localsystem.Container, len(containers))
 
-	var limits tempLimits
-	er := json.Unmarshal(with, &limits)
-	if er != nil {
-		return nerr.Translate(er)
-	}
+	for _, c := range containers {
+		hardwareInfoContainers.last[c.Name] = c
 
-	event := events.Event{
-		GeneratingSystem: systemID,
-		EventTags: []string{
-			events.HardwareInfo,
-		},
-		TargetDevice: deviceInfo,
-		AffectedRoom: deviceInfo.BasicRoomInfo,
-	}
+		prev, seen := last[c.Name]
+		exited := seen && prev.State == "running" && c.State != "running"
+		unhealthy := seen && prev.Health != localsystem.ContainerUnhealthy && c.Health == localsystem.ContainerUnhealthy
 
-	for {
-		select {
-		case t1 := <-ticker1.C:
-			//check to see if the temp is over the warning or critical threshold
+		metrics.Container(c.Name, c.State == "running", c.RestartCount, c.CPUPercent, c.MemoryMB)
 
-			info.Host, err = localsystem.HostInfo()
-			if err != nil {
-				return err.Addf("failed to get hardware info")
-			}
+		tmp := event
+		tmp.AddToTags(events.DetailState)
+		tmp.Key = fmt.Sprintf("container-%s-state", c.Name)
+		tmp.Value = c.State
+		tmp.Data = c
+		messenger.Get().SendEvent(tmp)
 
-			if temps, ok := info.Host["temperature"].(map[string]float64); ok {
-				for chip, temp := range temps {
-					oldTemp := previousTemps[chip]
-					if temp > limits.WarningThreshold {
-						if temp > limits.CriticalThreshold {
-							if oldTemp < limits.CriticalThreshold {
-								event.AddToTags(events.DetailState)
-								event.Key = "temp-critical"
-								event.Value = fmt.Sprintf("%v", temp)
-								event.Data = chip
-								event.Timestamp = t1
-								messenger.Get().SendEvent(event)
-							}
-						} else {
-							if oldTemp > limits.CriticalThreshold || oldTemp < limits.WarningThreshold {
-								event.AddToTags(events.DetailState)
-								event.Key = "temp-warning"
-								event.Value = fmt.Sprintf("%v", temp)
-								event.Data = chip
-								event.Timestamp = t1
-								messenger.Get().SendEvent(event)
-							}
-						}
-					}
-					previousTemps[chip] = temp
-				}
-			}
+		tmp = event
+		tmp.AddToTags(events.DetailState)
+		tmp.Key = fmt.Sprintf("container-%s-restarts", c.Name)
+		tmp.Value = fmt.Sprintf("%v", c.RestartCount)
+		messenger.Get().SendEvent(tmp)
 
-		case t2 := <-ticker2.C:
-			//give us the 5 minute check
+		if len(c.Health) > 0 {
+			tmp = event
+			tmp.AddToTags(events.DetailState)
+			tmp.Key = fmt.Sprintf("container-%s-health", c.Name)
+			tmp.Value = c.Health
+			messenger.Get().SendEvent(tmp)
+		}
 
-			info.Host, err = localsystem.HostInfo()
-			if err != nil {
-				return err.Addf("failed to get hardware info")
-			}
+		if exited {
+			tmp = event
+			tmp.AddToTags(events.DetailState, events.AutoGenerated, "alert")
+			tmp.Key = "container-exited"
+			tmp.Value = c.Name
+			tmp.Data = c
+			messenger.Get().SendEvent(tmp)
+		}
 
-			if temps, ok := info.Host["temperature"].(map[string]float64); ok {
-				for chip, temp := range temps {
-					if temp > limits.WarningThreshold {
-						if temp > limits.CriticalThreshold {
-							event.AddToTags(events.DetailState)
-							event.Key = "temp-critical"
-							event.Value = fmt.Sprintf("%v", temp)
-							event.Data = chip
-							event.Timestamp = t2
-							messenger.Get().SendEvent(event)
-						} else if temp > limits.WarningThreshold {
-							event.AddToTags(events.DetailState)
-							event.Key = "temp-warning"
-							event.Value = fmt.Sprintf("%v", temp)
-							event.Data = chip
-							event.Timestamp = t2
-							messenger.Get().SendEvent(event)
-						} else {
-							event.AddToTags(events.DetailState)
-							event.Key = "temp-normal"
-							event.Value = fmt.Sprintf("%v", temp)
-							event.Data = chip
-							event.Timestamp = t2
-							messenger.Get().SendEvent(event)
-						}
-					}
-				}
-			}
+		if unhealthy {
+			tmp = event
+			tmp.AddToTags(events.DetailState, events.AutoGenerated, "alert")
+			tmp.Key = "container-unhealthy"
+			tmp.Value = c.Name
+			tmp.Data = c
+			messenger.Get().SendEvent(tmp)
 		}
 	}
 }
@@ -0,0 +1,53 @@
+package then
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/byuoitav/common/nerr"
+	"github.com/byuoitav/common/v2/events"
+	"github.com/byuoitav/device-monitoring/actions/logwatch"
+	"github.com/byuoitav/device-monitoring/localsystem"
+	"github.com/byuoitav/device-monitoring/messenger"
+	"go.uber.org/zap"
+)
+
+// logWatch watches the kernel ring buffer and the journal until ctx is cancelled,
+// sending an event each time a known failure signature shows up.
+func logWatch(ctx context.Context, with []byte, log *zap.SugaredLogger) *nerr.E {
+	var config logwatch.Config
+	if len(with) > 0 {
+		if err := json.Unmarshal(with, &config); err != nil {
+			return nerr.Translate(err).Addf("unable to watch logs")
+		}
+	}
+
+	systemID, err := localsystem.SystemID()
+	if err != nil {
+		return err.Addf("unable to watch logs")
+	}
+
+	deviceInfo := events.GenerateBasicDeviceInfo(systemID)
+
+	return logwatch.Watch(ctx, config, func(match logwatch.Match) {
+		log.Infof("%s matched %d times", match.Signature, match.Count)
+
+		messenger.Get().SendEvent(events.Event{
+			GeneratingSystem: systemID,
+			Timestamp:        time.Now(),
+			EventTags: []string{
+				events.DetailState,
+				events.AutoGenerated,
+				"alert",
+				"log-watch",
+			},
+			TargetDevice: deviceInfo,
+			AffectedRoom: deviceInfo.BasicRoomInfo,
+			Key:          match.Signature,
+			Value:        fmt.Sprintf("%v", match.Count),
+			Data:         match,
+		})
+	}, log)
+}
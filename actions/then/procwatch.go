@@ -0,0 +1,89 @@
+package then
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/byuoitav/common/nerr"
+	"github.com/byuoitav/common/v2/events"
+	"github.com/byuoitav/device-monitoring/actions/procwatch"
+	"github.com/byuoitav/device-monitoring/localsystem"
+	"github.com/byuoitav/device-monitoring/messenger"
+	"go.uber.org/zap"
+)
+
+var processWatcher = procwatch.NewWatcher()
+
+func processWatch(ctx context.Context, with []byte, log *zap.SugaredLogger) *nerr.E {
+	var configs []procwatch.Config
+	if err := json.Unmarshal(with, &configs); err != nil {
+		return nerr.Translate(err).Addf("unable to watch processes")
+	}
+
+	systemID, err := localsystem.SystemID()
+	if err != nil {
+		return err.Addf("unable to watch processes")
+	}
+
+	deviceInfo := events.GenerateBasicDeviceInfo(systemID)
+
+	// timeout if this takes longer than 30 seconds
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+
+	statuses, changes, err := processWatcher.Check(ctx, configs)
+	if err != nil {
+		return err.Addf("unable to watch processes")
+	}
+
+	event := events.Event{
+		GeneratingSystem: systemID,
+		Timestamp:        time.Now(),
+		EventTags: []string{
+			events.DetailState,
+			events.AutoGenerated,
+		},
+		TargetDevice: deviceInfo,
+		AffectedRoom: deviceInfo.BasicRoomInfo,
+	}
+
+	for _, status := range statuses {
+		tmp := event
+		tmp.Key = fmt.Sprintf("%s-running", status.Name)
+		tmp.Value = fmt.Sprintf("%v", status.Running)
+		tmp.Data = status
+		messenger.Get().SendEvent(tmp)
+
+		tmp = event
+		tmp.Key = fmt.Sprintf("%s-restarts", status.Name)
+		tmp.Value = fmt.Sprintf("%v", status.Restarts)
+		messenger.Get().SendEvent(tmp)
+
+		if status.Running {
+			tmp = event
+			tmp.Key = fmt.Sprintf("%s-cpu-percent", status.Name)
+			tmp.Value = fmt.Sprintf("%v", status.CPUPercent)
+			messenger.Get().SendEvent(tmp)
+
+			tmp = event
+			tmp.Key = fmt.Sprintf("%s-rss-mb", status.Name)
+			tmp.Value = fmt.Sprintf("%v", status.RSSMB)
+			messenger.Get().SendEvent(tmp)
+		}
+	}
+
+	for _, change := range changes {
+		log.Infof("%s", change.Detail)
+
+		tmp := event
+		tmp.AddToTags("alert")
+		tmp.Key = change.Type
+		tmp.Value = change.Name
+		tmp.Data = change
+		messenger.Get().SendEvent(tmp)
+	}
+
+	return nil
+}
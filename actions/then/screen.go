@@ -0,0 +1,54 @@
+package then
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/byuoitav/common/nerr"
+	"github.com/byuoitav/common/v2/events"
+	"github.com/byuoitav/device-monitoring/actions/screencheck"
+	"github.com/byuoitav/device-monitoring/localsystem"
+	"github.com/byuoitav/device-monitoring/messenger"
+	"go.uber.org/zap"
+)
+
+// screenCheck takes screenshots until ctx is cancelled, sending an event with a thumbnail
+// each time the screen goes blank, freezes, shows a known error page, or goes back to normal.
+func screenCheck(ctx context.Context, with []byte, log *zap.SugaredLogger) *nerr.E {
+	var config screencheck.Config
+	if len(with) > 0 {
+		if err := json.Unmarshal(with, &config); err != nil {
+			return nerr.Translate(err).Addf("unable to check screen")
+		}
+	}
+
+	systemID, err := localsystem.SystemID()
+	if err != nil {
+		return err.Addf("unable to check screen")
+	}
+
+	deviceInfo := events.GenerateBasicDeviceInfo(systemID)
+
+	return screencheck.Watch(ctx, config, func(res screencheck.Result) {
+		event := events.Event{
+			GeneratingSystem: systemID,
+			Timestamp:        res.Timestamp,
+			EventTags: []string{
+				events.DetailState,
+				events.AutoGenerated,
+			},
+			TargetDevice: deviceInfo,
+			AffectedRoom: deviceInfo.BasicRoomInfo,
+			Key:          "screen-state",
+			Value:        res.State,
+			Data:         res,
+		}
+
+		if res.State != screencheck.OK {
+			event.AddToTags("alert")
+		}
+
+		messenger.Get().SendEvent(event)
+	}, log)
+}
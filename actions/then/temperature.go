@@ -0,0 +1,192 @@
+package then
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/byuoitav/common/nerr"
+	"github.com/byuoitav/common/v2/events"
+	"github.com/byuoitav/device-monitoring/actions/alerts"
+	"github.com/byuoitav/device-monitoring/localsystem"
+	"github.com/byuoitav/device-monitoring/messenger"
+	"go.uber.org/zap"
+)
+
+type temperatureConfig struct {
+	CriticalThreshold float64 `json:"critical-threshold"`
+	WarningThreshold  float64 `json:"warning-threshold"`
+
+	// Hysteresis is how many degrees below a threshold a chip must cool to before leaving that state
+	Hysteresis float64 `json:"hysteresis,omitempty"`
+
+	// SampleInterval is how often the temperature is checked. defaults to 5s
+	SampleInterval string `json:"sample-interval,omitempty"`
+
+	// ReportInterval is how often the state of every chip is reported. defaults to 5m
+	ReportInterval string `json:"report-interval,omitempty"`
+}
+
+type chipTemperature struct {
+	Chip          string       `json:"chip"`
+	Temperature   float64      `json:"temperature"`
+	State         alerts.Level `json:"state"`
+	PreviousState alerts.Level `json:"previous-state"`
+	Since         time.Time    `json:"since"`
+	CPUThrottled  bool         `json:"cpu-throttled"`
+}
+
+// liveTemperatureCheck monitors the temperature of each chip until ctx is cancelled, sending an event each time
+// a chip changes between normal, warning, and critical, and periodically reporting the state of every chip.
+func liveTemperatureCheck(ctx context.Context, with []byte, log *zap.SugaredLogger) *nerr.E {
+	config := temperatureConfig{
+		SampleInterval: "5s",
+		ReportInterval: "5m",
+	}
+
+	if err := json.Unmarshal(with, &config); err != nil {
+		return nerr.Translate(err).Addf("unable to monitor temperature")
+	}
+
+	switch {
+	case config.WarningThreshold <= 0:
+		return nerr.Createf("invalid", "unable to monitor temperature: warning threshold (%v) is missing or not positive", config.WarningThreshold)
+	case config.CriticalThreshold <= 0:
+		return nerr.Createf("invalid", "unable to monitor temperature: critical threshold (%v) is missing or not positive", config.CriticalThreshold)
+	case config.Hysteresis < 0:
+		return nerr.Createf("invalid", "unable to monitor temperature: hysteresis (%v) is negative", config.Hysteresis)
+	}
+
+	if config.WarningThreshold > config.CriticalThreshold {
+		return nerr.Createf("invalid", "unable to monitor temperature: warning threshold (%v) is above the critical threshold (%v)", config.WarningThreshold, config.CriticalThreshold)
+	}
+
+	sampleInterval, gerr := time.ParseDuration(config.SampleInterval)
+	if gerr != nil || sampleInterval <= 0 {
+		return nerr.Createf("invalid", "unable to monitor temperature: invalid sample interval '%s'", config.SampleInterval)
+	}
+
+	reportInterval, gerr := time.ParseDuration(config.ReportInterval)
+	if gerr != nil || reportInterval <= 0 {
+		return nerr.Createf("invalid", "unable to monitor temperature: invalid report interval '%s'", config.ReportInterval)
+	}
+
+	systemID, err := localsystem.SystemID()
+	if err != nil {
+		return err.Addf("unable to monitor temperature")
+	}
+
+	deviceInfo := events.GenerateBasicDeviceInfo(systemID)
+
+	rule := alerts.Rule{
+		Name:   "temperature",
+		Metric: "*",
+		Thresholds: alerts.Thresholds{
+			Warning:  &config.WarningThreshold,
+			Critical: &config.CriticalThreshold,
+		},
+		Hysteresis: config.Hysteresis,
+	}
+
+	engine := alerts.NewEngine()
+	chips := make(map[string]*chipTemperature)
+	throttled := false
+
+	send := func(chip chipTemperature, at time.Time) {
+		messenger.Get().SendEvent(events.Event{
+			GeneratingSystem: systemID,
+			Timestamp:        at,
+			EventTags: []string{
+				events.HardwareInfo,
+				events.DetailState,
+			},
+			TargetDevice: deviceInfo,
+			AffectedRoom: deviceInfo.BasicRoomInfo,
+			Key:          fmt.Sprintf("temp-%s", chip.State),
+			Value:        fmt.Sprintf("%v", chip.Temperature),
+			Data:         chip,
+		})
+	}
+
+	sample := func(at time.Time) {
+		temps, err := localsystem.Temperatures()
+		if err != nil {
+			log.Warnf("unable to get temperatures: %s", err.Error())
+			return
+		}
+
+		// check if the firmware is throttling the cpu
+		if mask, err := localsystem.Throttled(ctx); err != nil {
+			log.Debugf("unable to get throttled state: %s", err.Error())
+		} else if cur := mask&localsystem.ThrottledThrottled != 0; cur != throttled {
+			throttled = cur
+
+			messenger.Get().SendEvent(events.Event{
+				GeneratingSystem: systemID,
+				Timestamp:        at,
+				EventTags: []string{
+					events.HardwareInfo,
+					events.DetailState,
+				},
+				TargetDevice: deviceInfo,
+				AffectedRoom: deviceInfo.BasicRoomInfo,
+				Key:          "cpu-throttled",
+				Value:        fmt.Sprintf("%v", throttled),
+			})
+		}
+
+		for name, temp := range temps {
+			chip, ok := chips[name]
+			if !ok {
+				chip = &chipTemperature{
+					Chip:  name,
+					Since: at,
+				}
+
+				chips[name] = chip
+			}
+
+			chip.Temperature = temp
+			chip.CPUThrottled = throttled
+		}
+
+		changes, err := engine.Evaluate([]alerts.Rule{rule}, temps, nil, at)
+		if err != nil {
+			log.Warnf("unable to evaluate temperatures: %s", err.Error())
+			return
+		}
+
+		for _, change := range changes {
+			chip := chips[change.Metric]
+			chip.PreviousState = change.Previous
+			chip.State = change.Level
+			chip.Since = change.Timestamp
+
+			log.Infof("%s changed from %s to %s (%v°C)", chip.Chip, chip.PreviousState, chip.State, chip.Temperature)
+			send(*chip, at)
+		}
+	}
+
+	sampleTicker := time.NewTicker(sampleInterval)
+	defer sampleTicker.Stop()
+
+	reportTicker := time.NewTicker(reportInterval)
+	defer reportTicker.Stop()
+
+	sample(time.Now())
+
+	for {
+		select {
+		case <-ctx.Done():
+			log.Infof("Stopping temperature monitor: %s", ctx.Err())
+			return nil
+		case t := <-sampleTicker.C:
+			sample(t)
+		case t := <-reportTicker.C:
+			for _, chip := range chips {
+				send(*chip, t)
+			}
+		}
+	}
+}
@@ -17,22 +17,43 @@ import (
 	"github.com/byuoitav/device-monitoring/actions/roomstate"
 	"github.com/byuoitav/device-monitoring/localsystem"
 	"github.com/byuoitav/device-monitoring/messenger"
+	"github.com/byuoitav/device-monitoring/metrics"
 	"github.com/byuoitav/shipwright/actions/then"
 	"go.uber.org/zap"
 )
 
 func init() {
-	then.Add("ping-devices", pingDevices)
-	then.Add("active-signal", activeSignal)
-	then.Add("device-health-check", deviceHealthCheck)
-	then.Add("service-health-check", serviceHealthCheck)
-	then.Add("state-update", stateUpdate)
-	then.Add("websocket-browser-check", websocketBrowserCheck)
-
-	then.Add("hardware-info", hardwareInfo)
-	then.Add("device-hardware-info", deviceHardwareInfo)
-	then.Add("monitor-dividers", monitorDividerSensors)
-	then.Add("live-temperature-check", liveTemperatureCheck)
+	add("ping-devices", pingDevices)
+	add("active-signal", activeSignal)
+	add("device-health-check", deviceHealthCheck)
+	add("service-health-check", serviceHealthCheck)
+	add("state-update", stateUpdate)
+	add("websocket-browser-check", websocketBrowserCheck)
+
+	add("hardware-info", hardwareInfo)
+	add("device-hardware-info", deviceHardwareInfo)
+	add("monitor-dividers", monitorDividerSensors)
+	add("live-temperature-check", liveTemperatureCheck)
+	add("hardware-alerts", hardwareAlertCheck)
+	add("process-watch", processWatch)
+	add("log-watch", logWatch)
+	add("device-boot", deviceBoot)
+	add("dns-check", dnsCheck)
+	add("time-sync-check", timeSyncCheck)
+	add("screen-check", screenCheck)
+}
+
+type action func(ctx context.Context, with []byte, log *zap.SugaredLogger) *nerr.E
+
+// add registers an action, recording how many times it runs and how long each run takes
+func add(name string, a action) {
+	then.Add(name, func(ctx context.Context, with []byte, log *zap.SugaredLogger) *nerr.E {
+		start := time.Now()
+		err := a(ctx, with, log)
+
+		metrics.ActionRun(name, time.Since(start), err == nil)
+		return err
+	})
 }
 
 func pingDevices(ctx context.Context, with []byte, log *zap.SugaredLogger) *nerr.E {
@@ -61,6 +82,9 @@ func pingDevices(ctx context.Context, with []byte, log *zap.SugaredLogger) *nerr
 
 	// push up results
 	for id, result := range results {
+		rtt, _ := time.ParseDuration(result.AverageRoundTrip)
+		metrics.Ping(id, result.PacketsSent, result.PacketsSent-result.PacketsReceived, rtt)
+
 		event := events.Event{
 			GeneratingSystem: systemID,
 			Timestamp:        time.Now(),
@@ -169,6 +193,8 @@ func deviceHealthCheck(ctx context.Context, with []byte, log *zap.SugaredLogger)
 			event.Value = "No Response"
 		}
 
+		metrics.DeviceAPIHealth(id, status == health.Healthy)
+
 		messenger.Get().SendEvent(event)
 	}
 
@@ -193,6 +219,8 @@ func serviceHealthCheck(ctx context.Context, with []byte, log *zap.SugaredLogger
 	defer cancel()
 
 	resps := health.CheckServices(ctx, configs)
+	health.Record(resps)
+
 	for i := range resps {
 		messenger.Get().SendEvent(events.Event{
 			GeneratingSystem: systemID,
@@ -337,19 +365,22 @@ func monitorDividerSensors(ctx context.Context, with []byte, log *zap.SugaredLog
 	return nil
 }
 
+// websocketBrowserCheck restarts the browser if it isn't running or isn't connected to each service.
+// with is a browser.Config, or just a list of services to check
 func websocketBrowserCheck(ctx context.Context, with []byte, log *zap.SugaredLogger) *nerr.E {
-	var configs []browser.ServiceConfig
-	err := json.Unmarshal(with, &configs)
-	if err != nil {
-		return nerr.Translate(err).Addf("failed to check for websocket errors")
+	var config browser.Config
+	if err := json.Unmarshal(with, &config); err != nil {
+		if err := json.Unmarshal(with, &config.Services); err != nil {
+			return nerr.Translate(err).Addf("failed to check for websocket errors")
+		}
 	}
 
-	restarted, err := browser.CheckWebSocketCount(ctx, configs)
-	if err != nil {
-		return nerr.Translate(err).Addf("failed to check for websocket errors")
+	result, err := browser.Supervise(ctx, config)
+	if err != nil && !result.Restarted {
+		return err.Addf("failed to check for websocket errors")
 	}
 
-	if restarted {
+	if result.Restarted {
 		id := localsystem.MustSystemID()
 		deviceInfo := events.GenerateBasicDeviceInfo(id)
 		roomInfo := events.GenerateBasicRoomInfo(deviceInfo.RoomID)
@@ -361,8 +392,18 @@ func websocketBrowserCheck(ctx context.Context, with []byte, log *zap.SugaredLog
 		event.AffectedRoom = roomInfo
 		event.Key = "chrome-restarted"
 		event.Value = "true"
+		event.Data = result
 		messenger.Get().SendEvent(event)
+
+		if !result.Verified {
+			log.Warnf("browser didn't come back after restarting it: %s", result.Error)
+
+			event.AddToTags("alert")
+			event.Key = "browser-restart-failed"
+			event.Value = result.Reason
+			messenger.Get().SendEvent(event)
+		}
 	}
 
-	return nil
+	return err
 }
@@ -0,0 +1,189 @@
+package then
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/byuoitav/common/nerr"
+	"github.com/byuoitav/common/v2/events"
+	"github.com/byuoitav/device-monitoring/localsystem"
+	"github.com/byuoitav/device-monitoring/messenger"
+	"github.com/byuoitav/device-monitoring/metrics"
+	"go.uber.org/zap"
+)
+
+const defaultMaxClockOffset = time.Second
+
+type timeSyncConfig struct {
+	// Servers are the time servers the clock is compared with
+	Servers []string `json:"servers,omitempty"`
+
+	// MaxOffset is how far the clock can drift from a server before a clock-drift alert is sent (ie, 500ms).
+	// without Servers, it is compared with the offset the time daemon reports
+	MaxOffset string `json:"max-offset,omitempty"`
+}
+
+// the clock's synchronization the last time timeSyncCheck ran, so that an alert is only sent when it changes
+var (
+	lastClockSynced  bool
+	lastClockChecked bool
+	lastClockMu      sync.Mutex
+
+	// whether the clock had drifted from each server the last time it was checked
+	lastClockDrifted   = make(map[string]bool)
+	lastClockDriftedMu sync.Mutex
+)
+
+// timeSyncCheck checks that the clock is synchronized and hasn't drifted from the configured time servers
+func timeSyncCheck(ctx context.Context, with []byte, log *zap.SugaredLogger) *nerr.E {
+	var config timeSyncConfig
+	if len(with) > 0 {
+		if err := json.Unmarshal(with, &config); err != nil {
+			return nerr.Translate(err).Addf("unable to check time sync")
+		}
+	}
+
+	maxOffset := defaultMaxClockOffset
+	if len(config.MaxOffset) > 0 {
+		var err error
+
+		maxOffset, err = time.ParseDuration(config.MaxOffset)
+		if err != nil {
+			return nerr.Translate(err).Addf("unable to check time sync: invalid max-offset")
+		}
+	}
+
+	systemID, err := localsystem.SystemID()
+	if err != nil {
+		return err.Addf("unable to check time sync")
+	}
+
+	deviceInfo := events.GenerateBasicDeviceInfo(systemID)
+
+	// timeout if this takes longer than 30 seconds
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+
+	check, err := localsystem.CheckTime(ctx, config.Servers)
+	if err != nil {
+		return err.Addf("unable to check time sync")
+	}
+
+	metrics.ClockSynchronized(check.Status.Synchronized)
+
+	event := events.Event{
+		GeneratingSystem: systemID,
+		Timestamp:        time.Now(),
+		EventTags: []string{
+			events.DetailState,
+			events.AutoGenerated,
+		},
+		TargetDevice: deviceInfo,
+		AffectedRoom: deviceInfo.BasicRoomInfo,
+	}
+
+	tmp := event
+	tmp.Key = "clock-synchronized"
+	tmp.Value = fmt.Sprintf("%v", check.Status.Synchronized)
+	tmp.Data = check
+	messenger.Get().SendEvent(tmp)
+
+	if !check.Status.Synchronized {
+		log.Warnf("The clock isn't synchronized (source: %s)", check.Status.Source)
+	}
+
+	lastClockMu.Lock()
+	changed := lastClockSynced != check.Status.Synchronized
+	first := !lastClockChecked
+	lastClockSynced = check.Status.Synchronized
+	lastClockChecked = true
+	lastClockMu.Unlock()
+
+	// alert when the clock stops being synchronized, and clear it when it's synchronized again
+	if (first && !check.Status.Synchronized) || (!first && changed) {
+		tmp = event
+		tmp.AddToTags("alert")
+		tmp.Key = "clock-synchronized"
+		tmp.Value = fmt.Sprintf("%v", check.Status.Synchronized)
+		tmp.Data = check.Status
+
+		if check.Status.Synchronized {
+			tmp.AddToTags("alert-clear")
+			log.Infof("The clock is synchronized again (source: %s)", check.Status.Source)
+		} else {
+			tmp.AddToTags("alert-raise")
+		}
+
+		messenger.Get().SendEvent(tmp)
+	}
+
+	// without any servers, the offset the daemon reports is all there is to go on
+	if len(check.Servers) == 0 && check.Status.Offset != nil {
+		offset := time.Duration(*check.Status.Offset * float64(time.Second))
+		drifted := offset > maxOffset || offset < -maxOffset
+
+		if drifted {
+			log.Warnf("The clock is off by %v from %s (source: %s)", offset, check.Status.Server, check.Status.Source)
+		}
+
+		server := check.Status.Server
+		if len(server) == 0 {
+			server = check.Status.Source
+		}
+
+		clockDriftAlert(event, server, drifted, offset.String(), check.Status, log)
+	}
+
+	for _, server := range check.Servers {
+		if len(server.Error) > 0 {
+			log.Warnf("unable to query %s: %s", server.Server, server.Error)
+			continue
+		}
+
+		offset := server.OffsetDuration()
+		metrics.ClockOffset(server.Server, offset)
+
+		tmp = event
+		tmp.Key = "clock-offset-" + server.Server
+		tmp.Value = fmt.Sprintf("%.3f", offset.Seconds())
+		messenger.Get().SendEvent(tmp)
+
+		drifted := offset > maxOffset || offset < -maxOffset
+		if drifted {
+			log.Warnf("The clock is off by %v from %s", offset, server.Server)
+		}
+
+		clockDriftAlert(event, server.Server, drifted, server.Offset, server, log)
+	}
+
+	return nil
+}
+
+// clockDriftAlert raises a clock-drift alert for server when the clock drifts from it, and clears it when it's back within the max offset
+func clockDriftAlert(event events.Event, server string, drifted bool, value string, data interface{}, log *zap.SugaredLogger) {
+	lastClockDriftedMu.Lock()
+	prev, checked := lastClockDrifted[server]
+	lastClockDrifted[server] = drifted
+	lastClockDriftedMu.Unlock()
+
+	if prev == drifted && (checked || !drifted) {
+		return
+	}
+
+	event.AddToTags("alert")
+	event.Key = "clock-drift-" + server
+	event.Value = value
+	event.Data = data
+
+	if drifted {
+		event.AddToTags("alert-raise")
+	} else {
+		event.AddToTags("alert-clear")
+		log.Infof("The clock is within the max offset of %s again", server)
+	}
+
+	messenger.Get().SendEvent(event)
+}
@@ -0,0 +1,237 @@
+package audit
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/byuoitav/common/log"
+	"github.com/byuoitav/common/nerr"
+	"github.com/byuoitav/common/v2/events"
+	"github.com/byuoitav/device-monitoring/localsystem"
+	"github.com/byuoitav/device-monitoring/messenger"
+)
+
+const (
+	// DefaultPath is where the audit log is written if SetPath isn't called. relative paths are in the data directory
+	DefaultPath = "audit.log"
+
+	// MaxSize is how big the audit log can get before it is rotated. one rotated log is kept
+	MaxSize = 10 * 1024 * 1024
+
+	// Success means the call succeeded
+	Success = "success"
+
+	// Failure means the call was allowed, but failed
+	Failure = "failure"
+
+	// Denied means the caller wasn't allowed to make the call
+	Denied = "denied"
+)
+
+// Entry is a privileged call, or an action that restarted something
+type Entry struct {
+	Timestamp  time.Time         `json:"timestamp"`
+	Caller     string            `json:"caller,omitempty"`
+	AuthMethod string            `json:"auth-method,omitempty"`
+	RemoteAddr string            `json:"remote-addr,omitempty"`
+	Action     string            `json:"action"`
+	Method     string            `json:"method,omitempty"`
+	Path       string            `json:"path,omitempty"`
+	Parameters map[string]string `json:"parameters,omitempty"`
+	Role       string            `json:"role,omitempty"`
+	Status     int               `json:"status,omitempty"`
+	Outcome    string            `json:"outcome"`
+	Error      string            `json:"error,omitempty"`
+}
+
+// Filter limits which entries are returned by Query
+type Filter struct {
+	Since  time.Time
+	Caller string
+	Action string
+
+	// Limit is the most entries to return; the newest entries are kept
+	Limit int
+}
+
+var (
+	path = DefaultPath
+	mu   sync.Mutex
+)
+
+// SetPath changes where the audit log is written. relative paths are in the data directory
+func SetPath(p string) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	path = p
+}
+
+// Record writes an action that wasn't requested over http (ie, the browser being restarted by an action)
+func Record(action, caller string, params map[string]string, err error) {
+	entry := Entry{
+		Timestamp:  time.Now(),
+		Caller:     caller,
+		Action:     action,
+		Parameters: params,
+		Outcome:    Success,
+	}
+
+	if err != nil {
+		entry.Outcome = Failure
+		entry.Error = err.Error()
+	}
+
+	if err := Write(entry); err != nil {
+		log.L.Warnf("unable to write to audit log: %s", err.Error())
+	}
+}
+
+// Write appends entry to the audit log, and sends it to the hub
+func Write(entry Entry) *nerr.E {
+	b, err := json.Marshal(entry)
+	if err != nil {
+		return nerr.Translate(err).Addf("unable to write audit entry")
+	}
+
+	go send(entry)
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	file := localsystem.DataPath(path)
+	if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+		return nerr.Translate(err).Addf("unable to open audit log")
+	}
+
+	if err := rotate(file, len(b)+1); err != nil {
+		return err.Addf("unable to write audit entry")
+	}
+
+	f, err := os.OpenFile(file, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return nerr.Translate(err).Addf("unable to open audit log")
+	}
+	defer f.Close()
+
+	if _, err := f.Write(append(b, '\n')); err != nil {
+		return nerr.Translate(err).Addf("unable to write audit entry")
+	}
+
+	return nil
+}
+
+// Query returns the entries in the audit log that match filter, oldest first
+func Query(filter Filter) ([]Entry, *nerr.E) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	file := localsystem.DataPath(path)
+	entries := []Entry{}
+
+	for _, f := range []string{rotatedPath(file), file} {
+		var err *nerr.E
+		if entries, err = query(f, filter, entries); err != nil {
+			return nil, err
+		}
+	}
+
+	return entries, nil
+}
+
+// query appends the entries in the log at path that match filter to entries
+func query(path string, filter Filter, entries []Entry) ([]Entry, *nerr.E) {
+	f, err := os.Open(path)
+	switch {
+	case os.IsNotExist(err):
+		return entries, nil
+	case err != nil:
+		return nil, nerr.Translate(err).Addf("unable to open audit log")
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+
+	for scanner.Scan() {
+		var entry Entry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			// skip partially written lines
+			continue
+		}
+
+		switch {
+		case entry.Timestamp.Before(filter.Since):
+			continue
+		case len(filter.Caller) > 0 && entry.Caller != filter.Caller:
+			continue
+		case len(filter.Action) > 0 && entry.Action != filter.Action:
+			continue
+		}
+
+		entries = append(entries, entry)
+
+		if filter.Limit > 0 && len(entries) > filter.Limit {
+			entries = entries[1:]
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, nerr.Translate(err).Addf("unable to read audit log")
+	}
+
+	return entries, nil
+}
+
+// rotate moves the log at path to rotatedPath if writing n more bytes to it would make it bigger than MaxSize,
+// replacing the log that was rotated last time
+func rotate(path string, n int) *nerr.E {
+	info, err := os.Stat(path)
+	switch {
+	case os.IsNotExist(err):
+		return nil
+	case err != nil:
+		return nerr.Translate(err).Addf("unable to rotate audit log")
+	case info.Size()+int64(n) <= MaxSize:
+		return nil
+	}
+
+	if err := os.Rename(path, rotatedPath(path)); err != nil {
+		return nerr.Translate(err).Addf("unable to rotate audit log")
+	}
+
+	return nil
+}
+
+func rotatedPath(path string) string {
+	return path + ".1"
+}
+
+func send(entry Entry) {
+	systemID, err := localsystem.SystemID()
+	if err != nil {
+		log.L.Warnf("unable to send audit event: %s", err.Error())
+		return
+	}
+
+	deviceInfo := events.GenerateBasicDeviceInfo(systemID)
+
+	messenger.Get().SendEvent(events.Event{
+		GeneratingSystem: systemID,
+		Timestamp:        entry.Timestamp,
+		EventTags: []string{
+			events.DetailState,
+			"audit",
+		},
+		TargetDevice: deviceInfo,
+		AffectedRoom: deviceInfo.BasicRoomInfo,
+		Key:          "audit",
+		Value:        entry.Action,
+		User:         entry.Caller,
+		Data:         entry,
+	})
+}
@@ -0,0 +1,239 @@
+package auth
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/byuoitav/common/log"
+	"github.com/byuoitav/common/nerr"
+)
+
+// Role is what a caller is allowed to do. each role can do everything the roles below it can
+type Role int
+
+const (
+	// None can't call any protected endpoint
+	None Role = iota
+
+	// Read can view sensitive information (ie, screenshots and logs)
+	Read
+
+	// Operate can take actions that disrupt the device (ie, rebooting it)
+	Operate
+
+	// Admin can change how the device is configured
+	Admin
+)
+
+func (r Role) String() string {
+	switch r {
+	case Read:
+		return "read"
+	case Operate:
+		return "operate"
+	case Admin:
+		return "admin"
+	default:
+		return "none"
+	}
+}
+
+// MarshalText .
+func (r Role) MarshalText() ([]byte, error) {
+	return []byte(r.String()), nil
+}
+
+// UnmarshalText .
+func (r *Role) UnmarshalText(text []byte) error {
+	switch strings.ToLower(string(text)) {
+	case "read":
+		*r = Read
+	case "operate":
+		*r = Operate
+	case "admin":
+		*r = Admin
+	case "none", "":
+		*r = None
+	default:
+		return nerr.Createf("invalid", "invalid role '%s'", text)
+	}
+
+	return nil
+}
+
+// Identity is who made a request
+type Identity struct {
+	Name   string `json:"name"`
+	Method string `json:"method"`
+	Role   Role   `json:"role"`
+}
+
+// Authenticator figures out who made a request. it returns a nil identity if the request doesn't have the credentials it checks
+type Authenticator interface {
+	Authenticate(r *http.Request) (*Identity, *nerr.E)
+}
+
+// Config is who is allowed to call protected endpoints
+type Config struct {
+	// Keys are api keys, sent in the X-API-Key header or as a bearer token
+	Keys []Key `json:"keys,omitempty"`
+
+	// Certificates maps the common name of a verified client certificate to its role
+	Certificates map[string]Role `json:"certificates,omitempty"`
+}
+
+// Key is an api key
+type Key struct {
+	Name string `json:"name"`
+	Role Role   `json:"role"`
+
+	// Key is the key itself
+	Key string `json:"key,omitempty"`
+
+	// Hash is the hex encoded sha256 hash of the key, so that the key doesn't have to be stored on the device
+	Hash string `json:"hash,omitempty"`
+}
+
+var (
+	authenticators   []Authenticator
+	unauthenticated  bool
+	authenticatorsMu sync.RWMutex
+)
+
+// AllowUnauthenticated allows every request to protected endpoints while no authenticators have been added.
+// without it, protected endpoints refuse every request until auth is configured
+func AllowUnauthenticated(allow bool) {
+	authenticatorsMu.Lock()
+	defer authenticatorsMu.Unlock()
+
+	unauthenticated = allow
+}
+
+// Use adds authenticators that are tried, in order, on each protected request
+func Use(a ...Authenticator) {
+	authenticatorsMu.Lock()
+	defer authenticatorsMu.Unlock()
+
+	authenticators = append(authenticators, a...)
+}
+
+// Enabled returns true if any authenticators have been added. if none have, every request is refused unless AllowUnauthenticated was called
+func Enabled() bool {
+	authenticatorsMu.RLock()
+	defer authenticatorsMu.RUnlock()
+
+	return len(authenticators) > 0
+}
+
+// LoadConfig reads the config at path, and adds the authenticators it describes
+func LoadConfig(path string) *nerr.E {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nerr.Translate(err).Addf("unable to load auth config")
+	}
+
+	var config Config
+	if err := json.Unmarshal(b, &config); err != nil {
+		return nerr.Translate(err).Addf("unable to load auth config")
+	}
+
+	if len(config.Keys) > 0 {
+		keys, err := NewKeyAuthenticator(config.Keys)
+		if err != nil {
+			return err.Addf("unable to load auth config")
+		}
+
+		Use(keys)
+	}
+
+	if len(config.Certificates) > 0 {
+		Use(CertificateAuthenticator(config.Certificates))
+	}
+
+	log.L.Infof("Loaded auth config: %d keys, %d certificates", len(config.Keys), len(config.Certificates))
+	return nil
+}
+
+type keyAuthenticator struct {
+	keys []Key
+}
+
+// NewKeyAuthenticator authenticates requests with an api key in the X-API-Key header, or as a bearer token
+func NewKeyAuthenticator(keys []Key) (Authenticator, *nerr.E) {
+	a := &keyAuthenticator{}
+
+	for _, key := range keys {
+		switch {
+		case len(key.Name) == 0:
+			return nil, nerr.Create("api key is missing a name", "invalid")
+		case len(key.Key) == 0 && len(key.Hash) == 0:
+			return nil, nerr.Createf("invalid", "api key %s is missing a key or hash", key.Name)
+		case len(key.Key) > 0:
+			sum := sha256.Sum256([]byte(key.Key))
+			key.Hash = hex.EncodeToString(sum[:])
+			key.Key = ""
+		}
+
+		key.Hash = strings.ToLower(key.Hash)
+		a.keys = append(a.keys, key)
+	}
+
+	return a, nil
+}
+
+func (a *keyAuthenticator) Authenticate(r *http.Request) (*Identity, *nerr.E) {
+	token := r.Header.Get("X-API-Key")
+	if len(token) == 0 {
+		if header := r.Header.Get("Authorization"); strings.HasPrefix(header, "Bearer ") {
+			token = strings.TrimPrefix(header, "Bearer ")
+		}
+	}
+
+	if len(token) == 0 {
+		return nil, nil
+	}
+
+	sum := sha256.Sum256([]byte(token))
+	hash := []byte(hex.EncodeToString(sum[:]))
+
+	for _, key := range a.keys {
+		if subtle.ConstantTimeCompare(hash, []byte(key.Hash)) == 1 {
+			return &Identity{
+				Name:   key.Name,
+				Method: "api-key",
+				Role:   key.Role,
+			}, nil
+		}
+	}
+
+	return nil, nerr.Create("invalid api key", "unauthorized")
+}
+
+// CertificateAuthenticator authenticates requests with a client certificate that was verified by the tls server
+type CertificateAuthenticator map[string]Role
+
+// Authenticate .
+func (c CertificateAuthenticator) Authenticate(r *http.Request) (*Identity, *nerr.E) {
+	if r.TLS == nil || len(r.TLS.VerifiedChains) == 0 || len(r.TLS.VerifiedChains[0]) == 0 {
+		return nil, nil
+	}
+
+	name := r.TLS.VerifiedChains[0][0].Subject.CommonName
+
+	role, ok := c[name]
+	if !ok {
+		return nil, nerr.Createf("unauthorized", "certificate %s is not allowed", name)
+	}
+
+	return &Identity{
+		Name:   name,
+		Method: "certificate",
+		Role:   role,
+	}, nil
+}
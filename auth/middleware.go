@@ -0,0 +1,207 @@
+package auth
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/byuoitav/common/log"
+	"github.com/byuoitav/common/v2/events"
+	"github.com/byuoitav/device-monitoring/audit"
+	"github.com/labstack/echo"
+)
+
+const (
+	identityKey = "identity"
+
+	// the most of a body that's read to summarize it, and the longest a summarized value can be
+	maxSummaryBody  = 64 * 1024
+	maxSummaryValue = 256
+)
+
+// Require only allows requests from callers with at least role, and writes every request to the audit log
+func Require(role Role) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(ectx echo.Context) error {
+			body := summarizeBody(ectx)
+
+			id, status, msg := authenticate(ectx.Request(), role)
+			if id != nil {
+				ectx.Set(identityKey, id)
+			}
+
+			if status != http.StatusOK {
+				write(ectx, id, role, status, msg, body)
+				return ectx.String(status, msg)
+			}
+
+			err := next(ectx)
+
+			status = ectx.Response().Status
+			if he, ok := err.(*echo.HTTPError); ok {
+				status = he.Code
+			} else if err != nil {
+				status = http.StatusInternalServerError
+			}
+
+			write(ectx, id, role, status, "", body)
+			return err
+		}
+	}
+}
+
+// Caller returns who made the request, or the remote address if it wasn't authenticated
+func Caller(ectx echo.Context) string {
+	if id, ok := ectx.Get(identityKey).(*Identity); ok && id != nil {
+		return id.Name
+	}
+
+	return ectx.RealIP()
+}
+
+func authenticate(r *http.Request, role Role) (*Identity, int, string) {
+	authenticatorsMu.RLock()
+	defer authenticatorsMu.RUnlock()
+
+	// if auth isn't configured, everything is allowed only if that was asked for
+	if len(authenticators) == 0 {
+		if unauthenticated {
+			return nil, http.StatusOK, ""
+		}
+
+		return nil, http.StatusForbidden, "auth isn't configured on this device"
+	}
+
+	for _, a := range authenticators {
+		id, err := a.Authenticate(r)
+		switch {
+		case err != nil:
+			return nil, http.StatusUnauthorized, err.Error()
+		case id == nil:
+			continue
+		case id.Role < role:
+			return id, http.StatusForbidden, id.Name + " is not allowed to " + role.String()
+		default:
+			return id, http.StatusOK, ""
+		}
+	}
+
+	return nil, http.StatusUnauthorized, "missing credentials"
+}
+
+// parameters that are never written to the audit log
+var secretParams = map[string]bool{
+	"key":     true,
+	"token":   true,
+	"api-key": true,
+}
+
+// bodySummaries pick the parts of a request's body that are written to the audit log, by action
+var bodySummaries = map[string]func(b []byte) map[string]string{
+	"POST /event": func(b []byte) map[string]string {
+		var event events.Event
+		if err := json.Unmarshal(b, &event); err != nil {
+			return nil
+		}
+
+		return map[string]string{
+			"event-key":   event.Key,
+			"event-value": event.Value,
+		}
+	},
+	"POST /dns": func(b []byte) map[string]string {
+		var req struct {
+			Names []string `json:"names"`
+		}
+
+		if err := json.Unmarshal(b, &req); err != nil || len(req.Names) == 0 {
+			return nil
+		}
+
+		return map[string]string{
+			"names": strings.Join(req.Names, ","),
+		}
+	},
+}
+
+// summarizeBody returns the parts of the body to write to the audit log, leaving the body for the handler to read
+func summarizeBody(ectx echo.Context) map[string]string {
+	summarize, ok := bodySummaries[ectx.Request().Method+" "+ectx.Path()]
+	if !ok || ectx.Request().Body == nil {
+		return nil
+	}
+
+	req := ectx.Request()
+
+	b, err := ioutil.ReadAll(io.LimitReader(req.Body, maxSummaryBody))
+	req.Body = ioutil.NopCloser(io.MultiReader(bytes.NewReader(b), req.Body))
+	if err != nil {
+		return nil
+	}
+
+	summary := summarize(b)
+	for k, v := range summary {
+		if len(v) > maxSummaryValue {
+			summary[k] = v[:maxSummaryValue] + "..."
+		}
+	}
+
+	return summary
+}
+
+func write(ectx echo.Context, id *Identity, role Role, status int, msg string, body map[string]string) {
+	entry := audit.Entry{
+		Timestamp:  time.Now(),
+		RemoteAddr: ectx.RealIP(),
+		Action:     ectx.Request().Method + " " + ectx.Path(),
+		Method:     ectx.Request().Method,
+		Path:       ectx.Request().URL.Path,
+		Parameters: make(map[string]string),
+		Role:       role.String(),
+		Status:     status,
+		Outcome:    audit.Success,
+		Error:      msg,
+	}
+
+	switch {
+	case status == http.StatusUnauthorized || status == http.StatusForbidden:
+		entry.Outcome = audit.Denied
+	case status/100 != 2:
+		entry.Outcome = audit.Failure
+	}
+
+	for i, name := range ectx.ParamNames() {
+		if i < len(ectx.ParamValues()) {
+			entry.Parameters[name] = ectx.ParamValues()[i]
+		}
+	}
+
+	for name, value := range body {
+		entry.Parameters[name] = value
+	}
+
+	for name, values := range ectx.QueryParams() {
+		if !secretParams[strings.ToLower(name)] && len(values) > 0 {
+			entry.Parameters[name] = strings.Join(values, ",")
+		}
+	}
+
+	if len(entry.Parameters) == 0 {
+		entry.Parameters = nil
+	}
+
+	if id != nil {
+		entry.Caller = id.Name
+		entry.AuthMethod = id.Method
+	} else {
+		entry.Caller = ectx.RealIP()
+	}
+
+	if err := audit.Write(entry); err != nil {
+		log.L.Warnf("unable to write to audit log: %s", err.Error())
+	}
+}
@@ -42,7 +42,12 @@ export class DeviceInfoComponent implements OnInit {
     console.log("highest temp", this.highestTemp);
   }
 
+  // any section of the hardware info can be missing if it couldn't be collected (see hardwareInfo.errors)
   getHostList() {
+    if (!this.hardwareInfo.host || !this.hardwareInfo.host.os) {
+      return;
+    }
+
     this.hostList["Hostname"] = this.hardwareInfo.host.os.hostname
     let uptime = this.hardwareInfo.host.os.uptime/3600;
     this.hostList["Uptime"] = uptime.toFixed(2).toString() + " hours"
@@ -54,6 +59,10 @@ export class DeviceInfoComponent implements OnInit {
   }
 
   getMemoryList() {
+    if (!this.hardwareInfo.memory || !this.hardwareInfo.memory.swap || !this.hardwareInfo.memory.virtual) {
+      return;
+    }
+
     this.memoryList["Swap Total"] = this.formatBytes(this.hardwareInfo.memory.swap.total)
     this.memoryList["Swap Free"] = this.formatBytes(this.hardwareInfo.memory.swap.free)
     this.memoryList["Swap Used"] = this.formatBytes(this.hardwareInfo.memory.swap.used)
@@ -66,7 +75,11 @@ export class DeviceInfoComponent implements OnInit {
     this.memoryList["Virtual Used Percent"] = virtualPercent.toFixed(2).toString()+"%"
   }
 
-  getCPUList() {    
+  getCPUList() {
+    if (!this.hardwareInfo.cpu || !this.hardwareInfo.cpu.usage) {
+      return;
+    }
+
     let thing = this.hardwareInfo.cpu.usage;
     for (let [key] of Object.entries(thing)) {
       this.CPUList[key.toUpperCase()] = thing[key]
@@ -74,10 +87,19 @@ export class DeviceInfoComponent implements OnInit {
   }
 
   getDiskList() {
-    let thing = this.hardwareInfo.disk["io-counters"];
+    if (!this.hardwareInfo.disk) {
+      return;
+    }
+
+    let thing = this.hardwareInfo.disk["io-counters"] || {};
     for (let [key] of Object.entries(thing)) {
       this.diskList["Write Count"] = thing[key].writeCount
     }
+
+    if (!this.hardwareInfo.disk.usage) {
+      return;
+    }
+
     this.diskList["Total"] = this.formatBytes(this.hardwareInfo.disk.usage.total)
     this.diskList["Free"] = this.formatBytes(this.hardwareInfo.disk.usage.free)
     this.diskList["Used"] = this.formatBytes(this.hardwareInfo.disk.usage.used)
@@ -86,6 +108,10 @@ export class DeviceInfoComponent implements OnInit {
   }
 
   getDockerList() {
+    if (!this.hardwareInfo.docker || !this.hardwareInfo.docker.stats) {
+      return;
+    }
+
     for (let docker of this.hardwareInfo.docker.stats) {
       if (docker.running) {
         this.dockerList[docker.name] = "running "
@@ -97,6 +123,10 @@ export class DeviceInfoComponent implements OnInit {
   }
 
   getTempList() {
+    if (!this.hardwareInfo.host || !this.hardwareInfo.host.temperature) {
+      return;
+    }
+
     let thing = this.hardwareInfo.host.temperature;
     for (let [key] of Object.entries(thing)) {
       this.tempList[key] = thing[key]
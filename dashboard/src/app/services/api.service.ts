@@ -1,5 +1,5 @@
 import { Injectable } from "@angular/core";
-import { HttpClient } from "@angular/common/http";
+import { HttpClient, HttpHeaders } from "@angular/common/http";
 import { JsonConvert, OperationMode, ValueCheckingMode } from "json2typescript";
 
 import {
@@ -21,6 +21,10 @@ export class APIService {
   private jsonConvert: JsonConvert;
   private urlParams: URLSearchParams;
 
+  // protected endpoints (reboot, flush dns) need an api key when the server has an auth config.
+  // it can be given once with ?key=, or is asked for the first time one of them is refused
+  private apiKey: string;
+
   constructor(private http: HttpClient, private dialog: MatDialog) {
     this.jsonConvert = new JsonConvert();
     this.jsonConvert.ignorePrimitiveChecks = false;
@@ -29,6 +33,48 @@ export class APIService {
     if (this.urlParams.has("theme")) {
       this.theme = this.urlParams.get("theme");
     }
+
+    this.apiKey = localStorage.getItem("api-key");
+    if (this.urlParams.has("key")) {
+      this.setKey(this.urlParams.get("key"));
+
+      // don't leave the key in the address bar
+      this.urlParams.delete("key");
+      window.history.replaceState(
+        null,
+        "System Health Dashboard",
+        window.location.pathname + "?" + this.urlParams.toString()
+      );
+    }
+  }
+
+  private setKey(key: string) {
+    this.apiKey = key;
+    localStorage.setItem("api-key", key);
+  }
+
+  private authHeaders(): HttpHeaders {
+    let headers = new HttpHeaders();
+    if (this.apiKey) {
+      headers = headers.set("X-API-Key", this.apiKey);
+    }
+
+    return headers;
+  }
+
+  // askForKey asks for a new api key after a protected endpoint refused a request. it returns false if one wasn't given
+  private askForKey(status: number): boolean {
+    if (status !== 401 && status !== 403) {
+      return false;
+    }
+
+    const key = window.prompt("This device requires an API key with the operate role to do that. Enter one:");
+    if (!key) {
+      return false;
+    }
+
+    this.setKey(key);
+    return true;
   }
 
   public switchToUI() {
@@ -53,19 +99,30 @@ export class APIService {
 
   public async reboot() {
     try {
-      this.dialog.open(RebootComponent, { disableClose: true });
       const data = await this.http
-        .put("device/reboot", {
-          responseType: "text"
-        })
+        .put(
+          "device/reboot",
+          {
+            responseType: "text"
+          },
+          { headers: this.authHeaders() }
+        )
         .toPromise();
+
+      this.dialog.open(RebootComponent, { disableClose: true });
     } catch (e) {
       // bug where responseType doesn't actually work
       if (e.status === 200) {
+        this.dialog.open(RebootComponent, { disableClose: true });
+
         console.log(e.error.text);
         return e.error.text;
       }
 
+      if (this.askForKey(e.status)) {
+        return this.reboot();
+      }
+
       throw new Error("error getting rebooting device: " + e);
     }
   }
@@ -253,12 +310,18 @@ export class APIService {
   }
 
   public async flushDNS() {
-    this.http.get("/dns").subscribe((data: any) => {
-      if (data == "success") {
-        console.log("successfully flushed the dns cache");
-      } else {
-        console.log("failed to flush the dns cache");
+    this.http.post("/dns", {}, { headers: this.authHeaders() }).subscribe(
+      (data: any) => {
+        console.log("successfully flushed the dns cache", data);
+      },
+      (err: any) => {
+        if (this.askForKey(err.status)) {
+          this.flushDNS();
+          return;
+        }
+
+        console.log("failed to flush the dns cache", err.error);
       }
-    });
+    );
   }
 }
@@ -0,0 +1,53 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/byuoitav/device-monitoring/audit"
+	"github.com/labstack/echo"
+)
+
+const (
+	defaultAuditLimit = 100
+	maxAuditLimit     = 1000
+)
+
+// GetAuditLog returns entries from the audit log. ?since= can be a duration (ie, 6h) or an RFC3339 timestamp,
+// ?caller= and ?action= filter the entries, and ?limit= is the most (newest) entries to return (100 by default, up to 1000)
+func GetAuditLog(ectx echo.Context) error {
+	filter := audit.Filter{
+		Limit: defaultAuditLimit,
+	}
+
+	if s := ectx.QueryParam("since"); len(s) > 0 {
+		if d, err := time.ParseDuration(s); err == nil {
+			filter.Since = time.Now().Add(-d)
+		} else if t, err := time.Parse(time.RFC3339, s); err == nil {
+			filter.Since = t
+		} else {
+			return ectx.String(http.StatusBadRequest, fmt.Sprintf("invalid since '%s'", s))
+		}
+	}
+
+	if l := ectx.QueryParam("limit"); len(l) > 0 {
+		var err error
+
+		filter.Limit, err = strconv.Atoi(l)
+		if err != nil || filter.Limit <= 0 || filter.Limit > maxAuditLimit {
+			return ectx.String(http.StatusBadRequest, fmt.Sprintf("invalid limit '%s'; must be between 1 and %d", l, maxAuditLimit))
+		}
+	}
+
+	filter.Caller = ectx.QueryParam("caller")
+	filter.Action = ectx.QueryParam("action")
+
+	entries, err := audit.Query(filter)
+	if err != nil {
+		return ectx.String(http.StatusInternalServerError, err.Error())
+	}
+
+	return ectx.JSON(http.StatusOK, entries)
+}
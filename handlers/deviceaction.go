@@ -1,29 +1,105 @@
 package handlers
 
 import (
+	"fmt"
 	"net/http"
+	"strconv"
 	"time"
 
-	"github.com/byuoitav/common/log"
-	"github.com/byuoitav/device-monitoring/localsystem"
+	"github.com/byuoitav/device-monitoring/actions/browser"
+	"github.com/byuoitav/device-monitoring/actions/reboot"
+	"github.com/byuoitav/device-monitoring/auth"
+	"github.com/byuoitav/device-monitoring/watchdog"
 	"github.com/labstack/echo"
 )
 
-// RebootPi reboots the pi
-func RebootPi(context echo.Context) error {
-	go func() {
-		for i := 5; i > 0; i-- {
-			log.L.Infof("REBOOTING PI IN %v SECONDS", i)
-			time.Sleep(1 * time.Second)
+// RebootPi schedules a reboot of the pi. the time can be given with ?at= (RFC3339) or ?in= (a duration);
+// it defaults to 5 seconds from now. ?reason= is saved to be reported after the reboot, and ?force=true reboots even if the room is in use.
+func RebootPi(ectx echo.Context) error {
+	req := reboot.Request{
+		Reason:      ectx.QueryParam("reason"),
+		RequestedBy: auth.Caller(ectx),
+	}
+
+	if at := ectx.QueryParam("at"); len(at) > 0 {
+		t, err := time.Parse(time.RFC3339, at)
+		if err != nil {
+			return ectx.String(http.StatusBadRequest, fmt.Sprintf("invalid time '%s'", at))
+		}
+
+		req.At = t
+	}
+
+	if in := ectx.QueryParam("in"); len(in) > 0 {
+		d, err := time.ParseDuration(in)
+		if err != nil || d < 0 {
+			return ectx.String(http.StatusBadRequest, fmt.Sprintf("invalid duration '%s'", in))
 		}
 
-		err := localsystem.Reboot()
+		req.At = time.Now().Add(d)
+	}
+
+	if force := ectx.QueryParam("force"); len(force) > 0 {
+		var err error
+
+		req.Force, err = strconv.ParseBool(force)
 		if err != nil {
-			log.L.Errorf("failed to reboot pi: %v", err.Error())
+			return ectx.String(http.StatusBadRequest, fmt.Sprintf("invalid force '%s'", force))
+		}
+	}
+
+	p, err := reboot.Schedule(ectx.Request().Context(), req)
+	if err != nil {
+		switch err.Type {
+		case "invalid":
+			return ectx.String(http.StatusBadRequest, err.Error())
+		case "in-use":
+			return ectx.String(http.StatusConflict, err.Error())
+		default:
+			return ectx.String(http.StatusInternalServerError, err.Error())
+		}
+	}
+
+	return ectx.String(http.StatusOK, fmt.Sprintf("Rebooting in %v...", time.Until(p.At).Round(time.Second)))
+}
+
+// CancelReboot cancels a scheduled reboot
+func CancelReboot(ectx echo.Context) error {
+	reason := ectx.QueryParam("reason")
+	if len(reason) == 0 {
+		reason = fmt.Sprintf("cancelled by %s", auth.Caller(ectx))
+	}
+
+	p, err := reboot.Cancel(reason)
+	if err != nil {
+		if err.Type == "not-found" {
+			return ectx.String(http.StatusNotFound, err.Error())
 		}
-	}()
 
-	return context.Blob(http.StatusOK, "text/plain", []byte("Rebooting in 5 seconds..."))
+		return ectx.String(http.StatusInternalServerError, err.Error())
+	}
+
+	return ectx.JSON(http.StatusOK, p)
+}
+
+// GetScheduledReboot returns the scheduled reboot
+func GetScheduledReboot(ectx echo.Context) error {
+	p := reboot.Scheduled()
+	if p == nil {
+		return ectx.String(http.StatusNotFound, "no reboot is scheduled")
+	}
+
+	return ectx.JSON(http.StatusOK, p)
+}
+
+// GetWatchdogStatus returns the state of the watchdog
+func GetWatchdogStatus(ectx echo.Context) error {
+	return ectx.JSON(http.StatusOK, watchdog.GetStatus())
+}
+
+// GetBrowserStatus returns how many times the browser has been restarted, and why
+func GetBrowserStatus(ectx echo.Context) error {
+	return ectx.JSON(http.StatusOK, browser.GetStatus())
 }
 
 // SetDHCPState toggles dhcp to be on/off
@@ -4,6 +4,8 @@ import (
 	"context"
 	"fmt"
 	"net/http"
+	"regexp"
+	"strconv"
 	"time"
 
 	"github.com/byuoitav/common/nerr"
@@ -121,19 +123,93 @@ func GetDHCPState(ectx echo.Context) error {
 	return ectx.JSON(http.StatusOK, ret)
 }
 
-// GetScreenshot a screenshot of the device's screen
+// GetScreenshot a screenshot of the device's screen.
+// the image can be changed with ?format (jpeg, png, or webp), ?quality, ?max-width, ?region (x,y,width,height),
+// and which screen is captured with ?display, ?screen, and ?output
 func GetScreenshot(ectx echo.Context) error {
-	bytes, err := screenshot.Take(ectx.Request().Context())
+	opts, err := screenshotOptions(ectx)
 	if err != nil {
+		return ectx.String(http.StatusBadRequest, err.Error())
+	}
+
+	bytes, contentType, err := screenshot.Take(ectx.Request().Context(), opts)
+	if err != nil {
+		if err.Type == "invalid" {
+			return ectx.String(http.StatusBadRequest, err.Error())
+		}
+
 		return ectx.String(http.StatusInternalServerError, err.Error())
 	}
 
-	return ectx.Blob(http.StatusOK, "image/jpeg", bytes)
+	return ectx.Blob(http.StatusOK, contentType, bytes)
+}
+
+var localDisplay = regexp.MustCompile(`^:\d+(\.\d+)?$`)
+
+// screenshotOptions builds screenshot options from the query parameters
+func screenshotOptions(ectx echo.Context) (screenshot.Options, *nerr.E) {
+	opts := screenshot.Options{
+		Display: ectx.QueryParam("display"),
+		Output:  ectx.QueryParam("output"),
+		Format:  screenshot.ParseFormat(ectx.QueryParam("format")),
+	}
+
+	switch opts.Format {
+	case screenshot.JPEG, screenshot.PNG, screenshot.WebP:
+	default:
+		return opts, nerr.Createf("invalid", "unsupported format '%s'", opts.Format)
+	}
+
+	if screen := ectx.QueryParam("screen"); len(screen) > 0 {
+		if _, err := strconv.Atoi(screen); err != nil {
+			return opts, nerr.Createf("invalid", "invalid screen '%s'", screen)
+		}
+
+		if len(opts.Display) == 0 {
+			opts.Display = screenshot.DefaultDisplay
+		}
+
+		opts.Display += "." + screen
+	}
+
+	// only local displays; anything else makes the x client connect to another host
+	if len(opts.Display) > 0 && !localDisplay.MatchString(opts.Display) {
+		return opts, nerr.Createf("invalid", "invalid display '%s'; must be a local display (ie, :0 or :0.1)", opts.Display)
+	}
+
+	if q := ectx.QueryParam("quality"); len(q) > 0 {
+		var err error
+
+		opts.Quality, err = strconv.Atoi(q)
+		if err != nil || opts.Quality < 1 || opts.Quality > 100 {
+			return opts, nerr.Createf("invalid", "invalid quality '%s': must be between 1 and 100", q)
+		}
+	}
+
+	if w := ectx.QueryParam("max-width"); len(w) > 0 {
+		var err error
+
+		opts.MaxWidth, err = strconv.Atoi(w)
+		if err != nil || opts.MaxWidth < 1 {
+			return opts, nerr.Createf("invalid", "invalid max-width '%s'", w)
+		}
+	}
+
+	if r := ectx.QueryParam("region"); len(r) > 0 {
+		var err *nerr.E
+
+		opts.Region, err = screenshot.ParseRegion(r)
+		if err != nil {
+			return opts, err
+		}
+	}
+
+	return opts, nil
 }
 
 // HardwareInfo returns hardware info about this device
 func HardwareInfo(ectx echo.Context) error {
-	info, err := hardwareinfo.PiInfo()
+	info, err := hardwareinfo.PiInfo(ectx.Request().Context())
 	if err != nil {
 		return ectx.String(http.StatusInternalServerError, err.Error())
 	}
@@ -141,7 +217,45 @@ func HardwareInfo(ectx echo.Context) error {
 	return ectx.JSON(http.StatusOK, info)
 }
 
-// GetServiceHealth returns the health of services on this device
+// HardwareInfoHistory returns the history of a hardware metric, or of every metric if one isn't specified.
+// since can be a duration (ie, 6h) or an RFC3339 timestamp, and step is the duration to downsample to.
+func HardwareInfoHistory(ectx echo.Context) error {
+	since := time.Now().Add(-24 * time.Hour)
+	if s := ectx.QueryParam("since"); len(s) > 0 {
+		if d, err := time.ParseDuration(s); err == nil {
+			since = time.Now().Add(-d)
+		} else if t, err := time.Parse(time.RFC3339, s); err == nil {
+			since = t
+		} else {
+			return ectx.String(http.StatusBadRequest, fmt.Sprintf("invalid since '%s'", s))
+		}
+	}
+
+	var step time.Duration
+	if s := ectx.QueryParam("step"); len(s) > 0 {
+		var err error
+
+		step, err = time.ParseDuration(s)
+		if err != nil || step < 0 {
+			return ectx.String(http.StatusBadRequest, fmt.Sprintf("invalid step '%s'", s))
+		}
+	}
+
+	history := hardwareinfo.History()
+
+	if metric := ectx.QueryParam("metric"); len(metric) > 0 {
+		return ectx.JSON(http.StatusOK, history.Query(metric, since, step))
+	}
+
+	ret := make(map[string][]hardwareinfo.Point)
+	for _, metric := range history.Metrics() {
+		ret[metric] = history.Query(metric, since, step)
+	}
+
+	return ectx.JSON(http.StatusOK, ret)
+}
+
+// GetServiceHealth returns the health of services on this device. the results aren't added to the history
 func GetServiceHealth(ectx echo.Context) error {
 	var configs []health.ServiceCheckConfig
 	err := ectx.Bind(&configs)
@@ -156,3 +270,33 @@ func GetServiceHealth(ectx echo.Context) error {
 	resps := health.CheckServices(ctx, configs)
 	return ectx.JSON(http.StatusOK, resps)
 }
+
+// GetServiceHealthHistory returns the uptime and recent failures of each service that has been checked
+func GetServiceHealthHistory(ectx echo.Context) error {
+	failures := 5
+
+	if n := ectx.QueryParam("failures"); len(n) > 0 {
+		var err error
+
+		failures, err = strconv.Atoi(n)
+		if err != nil || failures < 0 {
+			return ectx.String(http.StatusBadRequest, fmt.Sprintf("invalid number of failures '%s'", n))
+		}
+	}
+
+	return ectx.JSON(http.StatusOK, health.ServiceHistory(failures))
+}
+
+// GetTimeSync returns whether the clock is synchronized, and how far it is from each ?server
+func GetTimeSync(ectx echo.Context) error {
+	// timeout if this takes longer than 15 seconds
+	ctx, cancel := context.WithTimeout(ectx.Request().Context(), 15*time.Second)
+	defer cancel()
+
+	check, err := localsystem.CheckTime(ctx, ectx.QueryParams()["server"])
+	if err != nil {
+		return ectx.String(http.StatusInternalServerError, err.Error())
+	}
+
+	return ectx.JSON(http.StatusOK, check)
+}
@@ -1,17 +1,116 @@
 package handlers
 
 import (
+	"context"
 	"net/http"
-	"os/exec"
+	"time"
 
+	"github.com/byuoitav/common/log"
+	"github.com/byuoitav/common/v2/events"
+	"github.com/byuoitav/device-monitoring/actions/dns"
+	"github.com/byuoitav/device-monitoring/localsystem"
+	"github.com/byuoitav/device-monitoring/messenger"
 	"github.com/labstack/echo"
 )
 
-func FlushDNS(c echo.Context) error {
-	cmd := exec.Command("sudo", "systemctl", "restart", "dnsmasq")
-	err := cmd.Run()
+// defaultVerifyNames are resolved after flushing if no names are given
+var defaultVerifyNames = []string{"google.com"}
+
+type flushDNSRequest struct {
+	Names []string `json:"names"`
+}
+
+// FlushDNS flushes the cache of each local dns resolver, then checks that the names in the body
+// (or ?name=) still resolve. it responds with the status of each resolver before and after the flush.
+func FlushDNS(ectx echo.Context) error {
+	var req flushDNSRequest
+	if ectx.Request().ContentLength > 0 {
+		if err := ectx.Bind(&req); err != nil {
+			return ectx.String(http.StatusBadRequest, err.Error())
+		}
+	}
+
+	req.Names = append(req.Names, ectx.QueryParams()["name"]...)
+	if len(req.Names) == 0 {
+		req.Names = defaultVerifyNames
+	}
+
+	ctx, cancel := context.WithTimeout(ectx.Request().Context(), 30*time.Second)
+	defer cancel()
+
+	flush, err := dns.FlushCache(ctx, req.Names)
+	if err != nil {
+		if err.Type == "not-found" {
+			return ectx.String(http.StatusNotFound, err.Error())
+		}
+
+		return ectx.String(http.StatusInternalServerError, err.Error())
+	}
+
+	if systemID, err := localsystem.SystemID(); err != nil {
+		log.L.Warnf("unable to send dns-flush event: %s", err.Error())
+	} else {
+		deviceInfo := events.GenerateBasicDeviceInfo(systemID)
+
+		value := "success"
+		if !flush.Success {
+			value = "failure"
+		}
+
+		messenger.Get().SendEvent(events.Event{
+			GeneratingSystem: systemID,
+			Timestamp:        time.Now(),
+			EventTags: []string{
+				events.DetailState,
+			},
+			TargetDevice: deviceInfo,
+			AffectedRoom: deviceInfo.BasicRoomInfo,
+			Key:          "dns-flush",
+			Value:        value,
+			Data:         flush,
+		})
+	}
+
+	if !flush.Success {
+		return ectx.JSON(http.StatusInternalServerError, flush)
+	}
+
+	return ectx.JSON(http.StatusOK, flush)
+}
+
+// CheckDNS resolves the names in the body against each nameserver, and optionally checks the devices in the room.
+// if the body is empty, the default names are resolved against the system's nameservers
+func CheckDNS(ectx echo.Context) error {
+	var config dns.CheckConfig
+	if ectx.Request().ContentLength > 0 {
+		if err := ectx.Bind(&config); err != nil {
+			return ectx.String(http.StatusBadRequest, err.Error())
+		}
+	}
+
+	if len(config.Names) == 0 && !config.CheckDevices {
+		for _, name := range defaultVerifyNames {
+			config.Names = append(config.Names, dns.NameConfig{Name: name})
+		}
+	}
+
+	roomID, err := localsystem.RoomID()
 	if err != nil {
-		return c.String(http.StatusInternalServerError, "failure")
+		return ectx.String(http.StatusInternalServerError, err.Error())
 	}
-	return c.String(http.StatusOK, "success")
+
+	// timeout if this takes longer than 30 seconds
+	ctx, cancel := context.WithTimeout(ectx.Request().Context(), 30*time.Second)
+	defer cancel()
+
+	check, err := dns.RunCheck(ctx, roomID, config)
+	if err != nil {
+		if err.Type == "invalid" {
+			return ectx.String(http.StatusBadRequest, err.Error())
+		}
+
+		return ectx.String(http.StatusInternalServerError, err.Error())
+	}
+
+	return ectx.JSON(http.StatusOK, check)
 }
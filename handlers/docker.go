@@ -0,0 +1,86 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/byuoitav/common/log"
+	"github.com/byuoitav/common/nerr"
+	"github.com/byuoitav/device-monitoring/auth"
+	"github.com/byuoitav/device-monitoring/localsystem"
+	"github.com/labstack/echo"
+)
+
+// GetContainers returns the status of every docker container on this device
+func GetContainers(ectx echo.Context) error {
+	ctx, cancel := context.WithTimeout(ectx.Request().Context(), 15*time.Second)
+	defer cancel()
+
+	containers, err := localsystem.Containers(ctx)
+	if err != nil {
+		return ectx.String(http.StatusInternalServerError, err.Error())
+	}
+
+	return ectx.JSON(http.StatusOK, containers)
+}
+
+// RestartContainer restarts a docker container. ?timeout= is how long to wait for it to stop before killing it
+func RestartContainer(ectx echo.Context) error {
+	name := ectx.Param("container")
+
+	timeout := 10 * time.Second
+	if t := ectx.QueryParam("timeout"); len(t) > 0 {
+		var err error
+
+		timeout, err = time.ParseDuration(t)
+		if err != nil || timeout < 0 {
+			return ectx.String(http.StatusBadRequest, fmt.Sprintf("invalid timeout '%s'", t))
+		}
+	}
+
+	log.L.Infof("Restarting container %s (requested by %s)", name, auth.Caller(ectx))
+
+	ctx, cancel := context.WithTimeout(ectx.Request().Context(), timeout+30*time.Second)
+	defer cancel()
+
+	if err := localsystem.RestartContainer(ctx, name, timeout); err != nil {
+		return ectx.String(containerErrorStatus(err), err.Error())
+	}
+
+	return ectx.String(http.StatusOK, fmt.Sprintf("restarted %s", name))
+}
+
+// GetContainerLogs returns the logs of a docker container. ?tail= is the number of lines to return (default 100, or 'all')
+func GetContainerLogs(ectx echo.Context) error {
+	name := ectx.Param("container")
+
+	tail := "100"
+	if t := ectx.QueryParam("tail"); len(t) > 0 {
+		if _, err := strconv.Atoi(t); err != nil && t != "all" {
+			return ectx.String(http.StatusBadRequest, fmt.Sprintf("invalid tail '%s'", t))
+		}
+
+		tail = t
+	}
+
+	ctx, cancel := context.WithTimeout(ectx.Request().Context(), 15*time.Second)
+	defer cancel()
+
+	logs, err := localsystem.ContainerLogs(ctx, name, tail)
+	if err != nil {
+		return ectx.String(containerErrorStatus(err), err.Error())
+	}
+
+	return ectx.String(http.StatusOK, logs)
+}
+
+func containerErrorStatus(err *nerr.E) int {
+	if err.Type == "not-found" {
+		return http.StatusNotFound
+	}
+
+	return http.StatusInternalServerError
+}
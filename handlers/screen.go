@@ -0,0 +1,146 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/byuoitav/common/log"
+	"github.com/byuoitav/device-monitoring/actions/screenshot"
+	"github.com/gorilla/websocket"
+	"github.com/labstack/echo"
+)
+
+const (
+	defaultStreamFPS = 2
+
+	streamBoundary  = "frame"
+	streamWriteWait = 10 * time.Second
+)
+
+var streamUpgrader = websocket.Upgrader{
+	ReadBufferSize:  1024,
+	WriteBufferSize: 64 * 1024,
+
+	CheckOrigin: sameOrigin,
+}
+
+// sameOrigin returns true if the websocket was opened by a page served from this host, or by a client that doesn't send an origin (ie, not a browser).
+// otherwise any page open in a browser that is logged in could watch the screen
+func sameOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if len(origin) == 0 {
+		return true
+	}
+
+	u, err := url.Parse(origin)
+	if err != nil {
+		return false
+	}
+
+	return strings.EqualFold(u.Host, r.Host)
+}
+
+// StreamScreen streams the screen at ?fps (default 2, max 10), as mjpeg or, if the request is a websocket upgrade, as binary websocket messages.
+// it takes the same parameters as GetScreenshot
+func StreamScreen(ectx echo.Context) error {
+	opts, err := screenshotOptions(ectx)
+	if err != nil {
+		return ectx.String(http.StatusBadRequest, err.Error())
+	}
+
+	fps := defaultStreamFPS
+	if f := ectx.QueryParam("fps"); len(f) > 0 {
+		var err error
+
+		fps, err = strconv.Atoi(f)
+		if err != nil || fps < 1 || fps > screenshot.MaxFPS {
+			return ectx.String(http.StatusBadRequest, fmt.Sprintf("invalid fps '%s': must be between 1 and %d", f, screenshot.MaxFPS))
+		}
+	}
+
+	if websocket.IsWebSocketUpgrade(ectx.Request()) {
+		return streamWebsocket(ectx, opts, fps)
+	}
+
+	return streamMJPEG(ectx, opts, fps)
+}
+
+func streamMJPEG(ectx echo.Context, opts screenshot.Options, fps int) error {
+	frames, done := screenshot.Subscribe(opts, fps)
+	defer done()
+
+	log.L.Infof("Streaming screen to %s at %d fps", ectx.Request().RemoteAddr, fps)
+
+	resp := ectx.Response()
+	resp.Header().Set(echo.HeaderContentType, "multipart/x-mixed-replace; boundary="+streamBoundary)
+	resp.Header().Set("Cache-Control", "no-cache")
+	resp.WriteHeader(http.StatusOK)
+
+	for {
+		select {
+		case <-ectx.Request().Context().Done():
+			log.L.Infof("Stopped streaming screen to %s", ectx.Request().RemoteAddr)
+			return nil
+		case frame := <-frames:
+			_, err := fmt.Fprintf(resp, "--%s\r\nContent-Type: %s\r\nContent-Length: %d\r\n\r\n", streamBoundary, frame.ContentType, len(frame.Data))
+			if err == nil {
+				_, err = resp.Write(frame.Data)
+			}
+
+			if err == nil {
+				_, err = resp.Write([]byte("\r\n"))
+			}
+
+			if err != nil {
+				log.L.Infof("Stopped streaming screen to %s: %s", ectx.Request().RemoteAddr, err)
+				return nil
+			}
+
+			resp.Flush()
+		}
+	}
+}
+
+func streamWebsocket(ectx echo.Context, opts screenshot.Options, fps int) error {
+	conn, err := streamUpgrader.Upgrade(ectx.Response(), ectx.Request(), nil)
+	if err != nil {
+		return ectx.String(http.StatusInternalServerError, fmt.Sprintf("unable to upgrade connection to a websocket: %s", err))
+	}
+	defer conn.Close()
+
+	frames, done := screenshot.Subscribe(opts, fps)
+	defer done()
+
+	log.L.Infof("Streaming screen to %s over websocket at %d fps", conn.RemoteAddr(), fps)
+
+	// the viewer doesn't send anything, but reading is how a close is noticed
+	closed := make(chan struct{})
+	go func() {
+		defer close(closed)
+
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}()
+
+	for {
+		select {
+		case <-closed:
+			log.L.Infof("Stopped streaming screen to %s", conn.RemoteAddr())
+			return nil
+		case frame := <-frames:
+			conn.SetWriteDeadline(time.Now().Add(streamWriteWait))
+
+			if err := conn.WriteMessage(websocket.BinaryMessage, frame.Data); err != nil {
+				log.L.Infof("Stopped streaming screen to %s: %s", conn.RemoteAddr(), err)
+				return nil
+			}
+		}
+	}
+}
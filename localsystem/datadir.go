@@ -0,0 +1,51 @@
+package localsystem
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// DefaultDataDir is where state that has to survive a reboot is saved if SetDataDir isn't called
+const DefaultDataDir = "/var/lib/device-monitoring"
+
+var (
+	dataDir   = DefaultDataDir
+	dataDirMu sync.Mutex
+)
+
+// SetDataDir changes the directory state that has to survive a reboot is saved in. it should be an absolute path
+func SetDataDir(dir string) {
+	dataDirMu.Lock()
+	defer dataDirMu.Unlock()
+
+	dataDir = dir
+}
+
+// DataPath returns where file is saved in the data directory. absolute paths are returned unchanged
+func DataPath(file string) string {
+	if filepath.IsAbs(file) {
+		return file
+	}
+
+	dataDirMu.Lock()
+	defer dataDirMu.Unlock()
+
+	return filepath.Join(dataDir, file)
+}
+
+// WriteData atomically replaces file in the data directory with b, creating the directory if it doesn't exist
+func WriteData(file string, b []byte) error {
+	path := DataPath(file)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+
+	tmp := filepath.Join(filepath.Dir(path), "."+filepath.Base(path)+".tmp")
+	if err := ioutil.WriteFile(tmp, b, 0644); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp, path)
+}
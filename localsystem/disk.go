@@ -0,0 +1,307 @@
+package localsystem
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/byuoitav/common/log"
+	"github.com/byuoitav/common/nerr"
+	"github.com/shirou/gopsutil/disk"
+)
+
+const (
+	blockDevicesPath = "/sys/block"
+	ext4StatsPath    = "/sys/fs/ext4"
+)
+
+// DiskConfig controls which filesystems and block devices are monitored.
+// if either list is empty, they are discovered automatically.
+type DiskConfig struct {
+	MountPoints []string `json:"mount-points,omitempty"`
+	Devices     []string `json:"devices,omitempty"`
+}
+
+// Disk is information about disk usage and io
+type Disk struct {
+	// Timestamp is when the io counters were read
+	Timestamp time.Time `json:"timestamp"`
+
+	// Usage is the usage of the root filesystem
+	Usage      *disk.UsageStat                `json:"usage,omitempty"`
+	IOCounters map[string]disk.IOCountersStat `json:"io-counters,omitempty"`
+
+	Filesystems []Filesystem `json:"filesystems,omitempty"`
+
+	// Throughput is only filled in by a DiskTracker
+	Throughput map[string]Throughput `json:"throughput,omitempty"`
+	Errors     map[string]string     `json:"errors,omitempty"`
+}
+
+// Filesystem is information about a mounted filesystem
+type Filesystem struct {
+	MountPoint string          `json:"mount-point"`
+	Device     string          `json:"device"`
+	Type       string          `json:"type"`
+	Options    string          `json:"options,omitempty"`
+	Usage      *disk.UsageStat `json:"usage,omitempty"`
+	ReadOnly   bool            `json:"read-only"`
+
+	// RemountedReadOnly is true if the filesystem was read-write in the previous sample given to a DiskTracker, and is now read-only
+	RemountedReadOnly bool `json:"remounted-read-only,omitempty"`
+
+	// ErrorCount is the number of errors the filesystem has recorded (ext4 only)
+	ErrorCount *uint64 `json:"error-count,omitempty"`
+}
+
+// Throughput is the rate of io on a block device between two samples
+type Throughput struct {
+	ReadBytesPerSec  float64 `json:"read-bytes-per-sec"`
+	WriteBytesPerSec float64 `json:"write-bytes-per-sec"`
+	ReadsPerSec      float64 `json:"reads-per-sec"`
+	WritesPerSec     float64 `json:"writes-per-sec"`
+	Interval         string  `json:"interval"`
+}
+
+// DiskTracker compares each sample it's given with the previous one, to calculate throughput and detect remounts.
+// each consumer should have its own, so that they don't consume each other's transitions
+type DiskTracker struct {
+	lastSample     time.Time
+	lastIOCounters map[string]disk.IOCountersStat
+	readOnly       map[string]bool
+	mu             sync.Mutex
+}
+
+var (
+	diskConfig   DiskConfig
+	diskConfigMu sync.RWMutex
+)
+
+// SetDiskConfig sets which filesystems and block devices DiskInfo reports on
+func SetDiskConfig(config DiskConfig) {
+	diskConfigMu.Lock()
+	defer diskConfigMu.Unlock()
+
+	diskConfig = config
+}
+
+// DiskInfo .
+func DiskInfo(ctx context.Context) (Disk, *nerr.E) {
+	diskConfigMu.RLock()
+	config := diskConfig
+	diskConfigMu.RUnlock()
+
+	info := Disk{
+		Errors: make(map[string]string),
+	}
+
+	filesystems, err := filesystems(config.MountPoints)
+	if err != nil {
+		return info, err.Addf("failed to get disk info")
+	}
+
+	devices := config.Devices
+	if len(devices) == 0 {
+		devices = blockDevices()
+	}
+
+	ioCounters, gerr := disk.IOCounters(devices...)
+	if gerr != nil {
+		info.Errors["io-counters"] = gerr.Error()
+	}
+
+	info.Timestamp = time.Now()
+
+	for i := range filesystems {
+		fs := &filesystems[i]
+
+		// a hung mount can't be interrupted, but the rest of them don't have to be checked
+		if ctx.Err() != nil {
+			info.Errors[fs.MountPoint] = ctx.Err().Error()
+			continue
+		}
+
+		usage, err := disk.Usage(fs.MountPoint)
+		if err != nil {
+			info.Errors[fs.MountPoint] = err.Error()
+		} else {
+			usage.UsedPercent = round(usage.UsedPercent, .01)
+			usage.InodesUsedPercent = round(usage.InodesUsedPercent, .01)
+			fs.Usage = usage
+		}
+
+		if fs.MountPoint == "/" {
+			info.Usage = fs.Usage
+		}
+	}
+
+	if len(ioCounters) > 0 {
+		info.IOCounters = ioCounters
+	}
+
+	info.Filesystems = filesystems
+
+	if len(info.Errors) == 0 {
+		info.Errors = nil
+	}
+
+	return info, nil
+}
+
+// Update fills in the throughput of info, and which of its filesystems were remounted read-only, since the previous sample
+func (t *DiskTracker) Update(info *Disk) {
+	if info == nil {
+		return
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.readOnly == nil {
+		t.readOnly = make(map[string]bool)
+	}
+
+	for i := range info.Filesystems {
+		fs := &info.Filesystems[i]
+
+		if wasReadOnly, ok := t.readOnly[fs.MountPoint]; ok && !wasReadOnly && fs.ReadOnly {
+			fs.RemountedReadOnly = true
+			log.L.Warnf("%s (%s) has been remounted read-only", fs.MountPoint, fs.Device)
+		}
+
+		t.readOnly[fs.MountPoint] = fs.ReadOnly
+	}
+
+	if len(info.IOCounters) == 0 {
+		return
+	}
+
+	lastSample, lastIOCounters := t.lastSample, t.lastIOCounters
+	t.lastSample, t.lastIOCounters = info.Timestamp, info.IOCounters
+
+	elapsed := info.Timestamp.Sub(lastSample)
+	if lastIOCounters == nil || elapsed <= 0 {
+		return
+	}
+
+	info.Throughput = make(map[string]Throughput)
+	secs := elapsed.Seconds()
+
+	for name, cur := range info.IOCounters {
+		prev, ok := lastIOCounters[name]
+		if !ok || cur.ReadBytes < prev.ReadBytes || cur.WriteBytes < prev.WriteBytes {
+			continue
+		}
+
+		info.Throughput[name] = Throughput{
+			ReadBytesPerSec:  round(float64(cur.ReadBytes-prev.ReadBytes)/secs, .01),
+			WriteBytesPerSec: round(float64(cur.WriteBytes-prev.WriteBytes)/secs, .01),
+			ReadsPerSec:      round(float64(cur.ReadCount-prev.ReadCount)/secs, .01),
+			WritesPerSec:     round(float64(cur.WriteCount-prev.WriteCount)/secs, .01),
+			Interval:         elapsed.String(),
+		}
+	}
+}
+
+// filesystems returns each mounted filesystem in mountPoints, or every physical filesystem if mountPoints is empty
+func filesystems(mountPoints []string) ([]Filesystem, *nerr.E) {
+	partitions, err := disk.Partitions(len(mountPoints) > 0)
+	if err != nil {
+		return nil, nerr.Translate(err).Addf("failed to get mounted filesystems")
+	}
+
+	wanted := make(map[string]bool)
+	for _, mp := range mountPoints {
+		wanted[mp] = true
+	}
+
+	var filesystems []Filesystem
+	for _, p := range partitions {
+		if len(wanted) > 0 && !wanted[p.Mountpoint] {
+			continue
+		}
+
+		fs := Filesystem{
+			MountPoint: p.Mountpoint,
+			Device:     p.Device,
+			Type:       p.Fstype,
+			Options:    p.Opts,
+		}
+
+		for _, opt := range strings.Split(p.Opts, ",") {
+			if opt == "ro" {
+				fs.ReadOnly = true
+				break
+			}
+		}
+
+		if p.Fstype == "ext4" {
+			fs.ErrorCount = ext4ErrorCount(p.Device)
+		}
+
+		filesystems = append(filesystems, fs)
+		delete(wanted, p.Mountpoint)
+	}
+
+	for mp := range wanted {
+		log.L.Warnf("unable to monitor %s: nothing is mounted there", mp)
+	}
+
+	if len(filesystems) == 0 {
+		return nil, nerr.Create("no filesystems found to monitor", "error")
+	}
+
+	return filesystems, nil
+}
+
+// blockDevices returns the name of each physical block device
+func blockDevices() []string {
+	infos, err := ioutil.ReadDir(blockDevicesPath)
+	if err != nil {
+		return nil
+	}
+
+	var devices []string
+	for _, info := range infos {
+		name := info.Name()
+
+		// skip virtual devices
+		if strings.HasPrefix(name, "loop") || strings.HasPrefix(name, "ram") || strings.HasPrefix(name, "zram") {
+			continue
+		}
+
+		if _, err := os.Stat(filepath.Join(blockDevicesPath, name, "device")); err != nil {
+			continue
+		}
+
+		devices = append(devices, name)
+	}
+
+	return devices
+}
+
+func ext4ErrorCount(device string) *uint64 {
+	dev := filepath.Base(device)
+
+	// the root device is sometimes listed as /dev/root, so resolve it to the real device
+	if resolved, err := filepath.EvalSymlinks(device); err == nil {
+		dev = filepath.Base(resolved)
+	}
+
+	b, err := ioutil.ReadFile(filepath.Join(ext4StatsPath, dev, "errors_count"))
+	if err != nil {
+		return nil
+	}
+
+	count, err := strconv.ParseUint(strings.TrimSpace(string(b)), 10, 64)
+	if err != nil {
+		return nil
+	}
+
+	return &count
+}
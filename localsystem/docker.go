@@ -0,0 +1,263 @@
+package localsystem
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/byuoitav/common/log"
+	"github.com/byuoitav/common/nerr"
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/client"
+	"github.com/docker/docker/pkg/stdcopy"
+	"github.com/shirou/gopsutil/docker"
+)
+
+const (
+	// ContainerUnhealthy is the health status docker reports when a container's health check is failing
+	ContainerUnhealthy = "unhealthy"
+
+	dockerTimeout = 15 * time.Second
+)
+
+// Docker is information about docker
+type Docker struct {
+	Stats             []docker.CgroupDockerStat `json:"stats,omitempty"`
+	RunningContainers int                       `json:"docker-containers"`
+
+	Containers []Container `json:"containers,omitempty"`
+}
+
+// Container is information about a docker container
+type Container struct {
+	ID           string    `json:"id"`
+	Name         string    `json:"name"`
+	Image        string    `json:"image"`
+	State        string    `json:"state"`
+	Status       string    `json:"status"`
+	Health       string    `json:"health,omitempty"`
+	ExitCode     int       `json:"exit-code"`
+	RestartCount int       `json:"restart-count"`
+	StartedAt    time.Time `json:"started-at,omitempty"`
+	Uptime       string    `json:"uptime,omitempty"`
+
+	CPUPercent    float64 `json:"cpu-percent"`
+	MemoryMB      float64 `json:"memory-mb"`
+	MemoryPercent float64 `json:"memory-percent"`
+}
+
+var (
+	dockerClient     *client.Client
+	dockerClientErr  error
+	dockerClientOnce sync.Once
+)
+
+func getDockerClient(ctx context.Context) (*client.Client, *nerr.E) {
+	dockerClientOnce.Do(func() {
+		dockerClient, dockerClientErr = client.NewEnvClient()
+		if dockerClientErr == nil {
+			dockerClient.NegotiateAPIVersion(ctx)
+		}
+	})
+
+	if dockerClientErr != nil {
+		return nil, nerr.Translate(dockerClientErr).Addf("failed to create docker client")
+	}
+
+	return dockerClient, nil
+}
+
+// DockerInfo .
+func DockerInfo(ctx context.Context) (Docker, *nerr.E) {
+	var info Docker
+
+	ctx, cancel := context.WithTimeout(ctx, dockerTimeout)
+	defer cancel()
+
+	containers, err := Containers(ctx)
+	if err != nil {
+		return info, err.Addf("failed to get docker info")
+	}
+
+	info.Containers = containers
+
+	for _, c := range containers {
+		if c.State == "running" {
+			info.RunningContainers++
+		}
+	}
+
+	// the cgroup stats aren't available on every system
+	stats, gerr := docker.GetDockerStatWithContext(ctx)
+	if gerr != nil {
+		log.L.Debugf("unable to get docker cgroup stats: %s", gerr)
+	} else {
+		info.Stats = stats
+	}
+
+	return info, nil
+}
+
+// Containers returns the status of every container, including the ones that aren't running
+func Containers(ctx context.Context) ([]Container, *nerr.E) {
+	cli, err := getDockerClient(ctx)
+	if err != nil {
+		return nil, err.Addf("failed to get containers")
+	}
+
+	list, gerr := cli.ContainerList(ctx, types.ContainerListOptions{All: true})
+	if gerr != nil {
+		return nil, nerr.Translate(gerr).Addf("failed to get containers")
+	}
+
+	containers := []Container{}
+
+	for _, item := range list {
+		c := Container{
+			ID:     item.ID,
+			Name:   containerName(item.Names),
+			Image:  item.Image,
+			State:  item.State,
+			Status: item.Status,
+		}
+
+		inspect, gerr := cli.ContainerInspect(ctx, item.ID)
+		if gerr != nil {
+			log.L.Warnf("unable to inspect container %s: %s", c.Name, gerr)
+		} else {
+			c.RestartCount = inspect.RestartCount
+
+			if inspect.State != nil {
+				c.ExitCode = inspect.State.ExitCode
+
+				if inspect.State.Health != nil {
+					c.Health = inspect.State.Health.Status
+				}
+
+				if t, err := time.Parse(time.RFC3339Nano, inspect.State.StartedAt); err == nil && inspect.State.Running {
+					c.StartedAt = t
+					c.Uptime = time.Since(t).Truncate(time.Second).String()
+				}
+			}
+		}
+
+		if c.State == "running" {
+			if err := containerUsage(ctx, cli, &c); err != nil {
+				log.L.Warnf("unable to get resource usage of container %s: %s", c.Name, err.Error())
+			}
+		}
+
+		containers = append(containers, c)
+	}
+
+	return containers, nil
+}
+
+// containerUsage fills in the cpu and memory usage of a running container
+func containerUsage(ctx context.Context, cli *client.Client, c *Container) *nerr.E {
+	resp, err := cli.ContainerStats(ctx, c.ID, false)
+	if err != nil {
+		return nerr.Translate(err).Addf("failed to get container stats")
+	}
+	defer resp.Body.Close()
+
+	var stats types.StatsJSON
+	if err := json.NewDecoder(resp.Body).Decode(&stats); err != nil {
+		return nerr.Translate(err).Addf("failed to decode container stats")
+	}
+
+	cpuDelta := float64(stats.CPUStats.CPUUsage.TotalUsage) - float64(stats.PreCPUStats.CPUUsage.TotalUsage)
+	systemDelta := float64(stats.CPUStats.SystemUsage) - float64(stats.PreCPUStats.SystemUsage)
+
+	cpus := float64(stats.CPUStats.OnlineCPUs)
+	if cpus == 0 {
+		cpus = float64(len(stats.CPUStats.CPUUsage.PercpuUsage))
+	}
+
+	if cpuDelta > 0 && systemDelta > 0 {
+		c.CPUPercent = round(cpuDelta/systemDelta*cpus*100, .01)
+	}
+
+	// page cache isn't really in use by the container
+	used := float64(stats.MemoryStats.Usage) - float64(stats.MemoryStats.Stats["cache"])
+	c.MemoryMB = round(used/1024/1024, .01)
+
+	if stats.MemoryStats.Limit > 0 {
+		c.MemoryPercent = round(used/float64(stats.MemoryStats.Limit)*100, .01)
+	}
+
+	return nil
+}
+
+// RestartContainer restarts the container with the given name or id
+func RestartContainer(ctx context.Context, name string, timeout time.Duration) *nerr.E {
+	cli, err := getDockerClient(ctx)
+	if err != nil {
+		return err.Addf("failed to restart container %s", name)
+	}
+
+	if err := cli.ContainerRestart(ctx, name, &timeout); err != nil {
+		if client.IsErrNotFound(err) {
+			return nerr.Createf("not-found", "container %s does not exist", name)
+		}
+
+		return nerr.Translate(err).Addf("failed to restart container %s", name)
+	}
+
+	log.L.Infof("Restarted container %s", name)
+	return nil
+}
+
+// ContainerLogs returns the last tail lines of the logs of the container with the given name or id
+func ContainerLogs(ctx context.Context, name string, tail string) (string, *nerr.E) {
+	cli, err := getDockerClient(ctx)
+	if err != nil {
+		return "", err.Addf("failed to get logs for container %s", name)
+	}
+
+	inspect, gerr := cli.ContainerInspect(ctx, name)
+	if gerr != nil {
+		if client.IsErrNotFound(gerr) {
+			return "", nerr.Createf("not-found", "container %s does not exist", name)
+		}
+
+		return "", nerr.Translate(gerr).Addf("failed to get logs for container %s", name)
+	}
+
+	reader, gerr := cli.ContainerLogs(ctx, name, types.ContainerLogsOptions{
+		ShowStdout: true,
+		ShowStderr: true,
+		Timestamps: true,
+		Tail:       tail,
+	})
+	if gerr != nil {
+		return "", nerr.Translate(gerr).Addf("failed to get logs for container %s", name)
+	}
+	defer reader.Close()
+
+	var buf bytes.Buffer
+
+	// containers without a tty have stdout and stderr multiplexed into one stream
+	if inspect.Config != nil && inspect.Config.Tty {
+		_, gerr = buf.ReadFrom(reader)
+	} else {
+		_, gerr = stdcopy.StdCopy(&buf, &buf, reader)
+	}
+
+	if gerr != nil {
+		return "", nerr.Translate(gerr).Addf("failed to read logs for container %s", name)
+	}
+
+	return buf.String(), nil
+}
+
+func containerName(names []string) string {
+	if len(names) == 0 {
+		return ""
+	}
+
+	return strings.TrimPrefix(names[0], "/")
+}
@@ -0,0 +1,302 @@
+package localsystem
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/byuoitav/common/nerr"
+)
+
+const (
+	throttledSysfsPath = "/sys/devices/platform/soc/soc:firmware/get_throttled"
+	cpuFreqPath        = "/sys/devices/system/cpu/cpu0/cpufreq/scaling_cur_freq"
+	mmcRootPath        = "/sys/class/mmc_host"
+
+	// vcgencmd can hang if the firmware mailbox is wedged
+	vcgencmdTimeout = 5 * time.Second
+
+	// ThrottledUnderVoltage is set in the throttled bitmask while the pi is under-voltage
+	ThrottledUnderVoltage = 1 << 0
+
+	// ThrottledFrequencyCapped is set in the throttled bitmask while the arm frequency is capped
+	ThrottledFrequencyCapped = 1 << 1
+
+	// ThrottledThrottled is set in the throttled bitmask while the cpu is throttled
+	ThrottledThrottled = 1 << 2
+
+	// ThrottledSoftTempLimit is set in the throttled bitmask while the soft temperature limit is active
+	ThrottledSoftTempLimit = 1 << 3
+
+	// the bits for each condition are shifted by this much to say that it has occurred since boot
+	throttledOccurredShift = 16
+)
+
+// ThrottledState is the decoded throttled bitmask from the pi's firmware
+type ThrottledState struct {
+	Raw string `json:"raw"`
+
+	UnderVoltage    bool `json:"under-voltage"`
+	FrequencyCapped bool `json:"frequency-capped"`
+	Throttled       bool `json:"throttled"`
+	SoftTempLimit   bool `json:"soft-temp-limit"`
+
+	UnderVoltageOccurred    bool `json:"under-voltage-occurred"`
+	FrequencyCappedOccurred bool `json:"frequency-capped-occurred"`
+	ThrottledOccurred       bool `json:"throttled-occurred"`
+	SoftTempLimitOccurred   bool `json:"soft-temp-limit-occurred"`
+}
+
+// StorageHealth is the identity and wear information an SD card or eMMC reports about itself
+type StorageHealth struct {
+	Device       string `json:"device"`
+	Type         string `json:"type,omitempty"`
+	Name         string `json:"name,omitempty"`
+	Manufacturer string `json:"manufacturer-id,omitempty"`
+	Serial       string `json:"serial,omitempty"`
+	Date         string `json:"date,omitempty"`
+
+	// LifeTimeUsed is the estimated percent of the device's life that has been used (eMMC only)
+	LifeTimeUsed *int `json:"life-time-used-percent,omitempty"`
+
+	// PreEOL is the pre end-of-life state of the device (normal, warning, or urgent) (eMMC only)
+	PreEOL string `json:"pre-eol,omitempty"`
+}
+
+// PiHealth is the firmware reported health of the pi
+type PiHealth struct {
+	Throttled *ThrottledState   `json:"throttled,omitempty"`
+	ClocksMHz map[string]int    `json:"clocks-mhz,omitempty"`
+	CoreVolts *float64          `json:"core-volts,omitempty"`
+	Storage   []StorageHealth   `json:"storage,omitempty"`
+	Errors    map[string]string `json:"errors,omitempty"`
+}
+
+// Throttled returns the throttled bitmask reported by the pi's firmware
+func Throttled(ctx context.Context) (uint32, *nerr.E) {
+	// newer kernels expose the bitmask in sysfs, so try there first
+	if b, err := ioutil.ReadFile(throttledSysfsPath); err == nil {
+		val, err := strconv.ParseUint(strings.TrimSpace(string(b)), 16, 32)
+		if err == nil {
+			return uint32(val), nil
+		}
+	}
+
+	out, err := vcgencmd(ctx, "get_throttled")
+	if err != nil {
+		return 0, err.Addf("failed to get throttled state")
+	}
+
+	// output looks like: throttled=0x50005
+	str := strings.TrimPrefix(out, "throttled=")
+
+	val, gerr := strconv.ParseUint(strings.TrimPrefix(str, "0x"), 16, 32)
+	if gerr != nil {
+		return 0, nerr.Translate(gerr).Addf("failed to parse throttled state '%s'", out)
+	}
+
+	return uint32(val), nil
+}
+
+// DecodeThrottled decodes the throttled bitmask
+func DecodeThrottled(mask uint32) ThrottledState {
+	occurred := mask >> throttledOccurredShift
+
+	return ThrottledState{
+		Raw: fmt.Sprintf("0x%x", mask),
+
+		UnderVoltage:    mask&ThrottledUnderVoltage != 0,
+		FrequencyCapped: mask&ThrottledFrequencyCapped != 0,
+		Throttled:       mask&ThrottledThrottled != 0,
+		SoftTempLimit:   mask&ThrottledSoftTempLimit != 0,
+
+		UnderVoltageOccurred:    occurred&ThrottledUnderVoltage != 0,
+		FrequencyCappedOccurred: occurred&ThrottledFrequencyCapped != 0,
+		ThrottledOccurred:       occurred&ThrottledThrottled != 0,
+		SoftTempLimitOccurred:   occurred&ThrottledSoftTempLimit != 0,
+	}
+}
+
+// PiHealthInfo reads the throttled state, clock speeds, core voltage, and storage health of the pi.
+// each piece is read independently; an error is only returned if none of them could be read.
+func PiHealthInfo(ctx context.Context) (PiHealth, *nerr.E) {
+	info := PiHealth{
+		Errors: make(map[string]string),
+	}
+
+	if mask, err := Throttled(ctx); err != nil {
+		info.Errors["throttled"] = err.Error()
+	} else {
+		state := DecodeThrottled(mask)
+		info.Throttled = &state
+	}
+
+	if c, err := clocks(ctx); err != nil {
+		info.Errors["clocks"] = err.Error()
+	} else {
+		info.ClocksMHz = c
+	}
+
+	if volts, err := coreVolts(ctx); err != nil {
+		info.Errors["core-volts"] = err.Error()
+	} else {
+		info.CoreVolts = &volts
+	}
+
+	if storage, err := storageHealth(); err != nil {
+		info.Errors["storage"] = err.Error()
+	} else {
+		info.Storage = storage
+	}
+
+	if info.Throttled == nil && info.ClocksMHz == nil && info.CoreVolts == nil && info.Storage == nil {
+		return info, nerr.Createf("error", "failed to get pi health: %v", info.Errors)
+	}
+
+	if len(info.Errors) == 0 {
+		info.Errors = nil
+	}
+
+	return info, nil
+}
+
+func clocks(ctx context.Context) (map[string]int, *nerr.E) {
+	clocks := make(map[string]int)
+
+	for _, clock := range []string{"arm", "core"} {
+		// output looks like: frequency(48)=600000000
+		out, err := vcgencmd(ctx, "measure_clock", clock)
+		if err != nil {
+			continue
+		}
+
+		split := strings.SplitN(out, "=", 2)
+		if len(split) != 2 {
+			continue
+		}
+
+		hz, gerr := strconv.ParseInt(split[1], 10, 64)
+		if gerr != nil {
+			continue
+		}
+
+		clocks[clock] = int(hz / 1000000)
+	}
+
+	// fall back to the kernel's view of the arm clock
+	if _, ok := clocks["arm"]; !ok {
+		if b, err := ioutil.ReadFile(cpuFreqPath); err == nil {
+			if khz, err := strconv.ParseInt(strings.TrimSpace(string(b)), 10, 64); err == nil {
+				clocks["arm"] = int(khz / 1000)
+			}
+		}
+	}
+
+	if len(clocks) == 0 {
+		return nil, nerr.Create("failed to get clock speeds", "error")
+	}
+
+	return clocks, nil
+}
+
+func coreVolts(ctx context.Context) (float64, *nerr.E) {
+	// output looks like: volt=1.2000V
+	out, err := vcgencmd(ctx, "measure_volts", "core")
+	if err != nil {
+		return 0, err.Addf("failed to get core voltage")
+	}
+
+	str := strings.TrimSuffix(strings.TrimPrefix(out, "volt="), "V")
+
+	volts, gerr := strconv.ParseFloat(str, 64)
+	if gerr != nil {
+		return 0, nerr.Translate(gerr).Addf("failed to parse core voltage '%s'", out)
+	}
+
+	return volts, nil
+}
+
+// storageHealth reads the health of each SD card/eMMC from sysfs
+func storageHealth() ([]StorageHealth, *nerr.E) {
+	devices, err := filepath.Glob(filepath.Join(mmcRootPath, "*", "mmc*:*"))
+	if err != nil {
+		return nil, nerr.Translate(err).Addf("failed to get storage health")
+	}
+
+	if len(devices) == 0 {
+		return nil, nerr.Createf("error", "failed to get storage health: no devices found in %s", mmcRootPath)
+	}
+
+	var storage []StorageHealth
+
+	for _, dev := range devices {
+		health := StorageHealth{
+			Device:       filepath.Base(dev),
+			Type:         readSysfs(dev, "type"),
+			Name:         readSysfs(dev, "name"),
+			Manufacturer: readSysfs(dev, "manfid"),
+			Serial:       readSysfs(dev, "serial"),
+			Date:         readSysfs(dev, "date"),
+		}
+
+		// life_time looks like "0x01 0x02", where each value is in 10% steps of life used (type a and type b memory)
+		if lifeTime := strings.Fields(readSysfs(dev, "life_time")); len(lifeTime) > 0 {
+			used := 0
+
+			for _, lt := range lifeTime {
+				v, err := strconv.ParseInt(strings.TrimPrefix(lt, "0x"), 16, 32)
+				if err != nil || v == 0 {
+					continue
+				}
+
+				if percent := int(v) * 10; percent > used {
+					used = percent
+				}
+			}
+
+			if used > 0 {
+				health.LifeTimeUsed = &used
+			}
+		}
+
+		switch readSysfs(dev, "pre_eol_info") {
+		case "0x01":
+			health.PreEOL = "normal"
+		case "0x02":
+			health.PreEOL = "warning"
+		case "0x03":
+			health.PreEOL = "urgent"
+		}
+
+		storage = append(storage, health)
+	}
+
+	return storage, nil
+}
+
+func readSysfs(dir, file string) string {
+	b, err := ioutil.ReadFile(filepath.Join(dir, file))
+	if err != nil {
+		return ""
+	}
+
+	return strings.TrimSpace(string(b))
+}
+
+// vcgencmd runs vcgencmd with args, killing it if it takes longer than vcgencmdTimeout
+func vcgencmd(ctx context.Context, args ...string) (string, *nerr.E) {
+	ctx, cancel := context.WithTimeout(ctx, vcgencmdTimeout)
+	defer cancel()
+
+	out, err := exec.CommandContext(ctx, "vcgencmd", args...).Output()
+	if err != nil {
+		return "", nerr.Translate(err).Addf("failed to run vcgencmd %s", strings.Join(args, " "))
+	}
+
+	return strings.TrimSpace(string(out)), nil
+}
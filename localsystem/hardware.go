@@ -1,7 +1,6 @@
 package localsystem
 
 import (
-	"context"
 	"fmt"
 	"io/ioutil"
 	"math"
@@ -10,36 +9,46 @@ import (
 	"path/filepath"
 	"strconv"
 	"strings"
-	"sync"
-	"time"
 
-	"github.com/byuoitav/common/log"
 	"github.com/byuoitav/common/nerr"
-	"github.com/docker/docker/api/types"
-	"github.com/docker/docker/client"
 	"github.com/shirou/gopsutil/cpu"
-	"github.com/shirou/gopsutil/disk"
-	"github.com/shirou/gopsutil/docker"
 	"github.com/shirou/gopsutil/host"
 	"github.com/shirou/gopsutil/load"
 	"github.com/shirou/gopsutil/mem"
-	"github.com/shirou/gopsutil/process"
 )
 
 const (
 	temperatureRootPath = "/sys/class/thermal"
-	uSleepCheckInterval = 3 * time.Second
-	uSleepResetInterval = 5 * time.Minute
 )
 
-var (
-	avgProcsInit     sync.Once
-	avgProcsInUSleep float64
-)
+// CPU is information about the cpu
+type CPU struct {
+	Hardware []cpu.InfoStat `json:"hardware,omitempty"`
+
+	// Usage is the percent usage of each cpu (cpu0, cpu1, ...), and the average of all of them (avg)
+	Usage map[string]float64 `json:"usage,omitempty"`
+
+	LoadAvg1Min  float64 `json:"avg1min"`
+	LoadAvg5Min  float64 `json:"avg5min"`
+	LoadAvg15Min float64 `json:"avg15min"`
+}
+
+// Memory is information about virtual and swap memory
+type Memory struct {
+	Virtual *mem.VirtualMemoryStat `json:"virtual,omitempty"`
+	Swap    *mem.SwapMemoryStat    `json:"swap,omitempty"`
+}
+
+// Host is information about the os, logged in users, and temperature of the device
+type Host struct {
+	OS          *host.InfoStat     `json:"os,omitempty"`
+	Users       []host.UserStat    `json:"users,omitempty"`
+	Temperature map[string]float64 `json:"temperature,omitempty"`
+}
 
 // CPUInfo .
-func CPUInfo() (map[string]interface{}, *nerr.E) {
-	info := make(map[string]interface{})
+func CPUInfo() (CPU, *nerr.E) {
+	var info CPU
 
 	// get hardware info about cpu
 	cpuState, err := cpu.Info()
@@ -47,11 +56,10 @@ func CPUInfo() (map[string]interface{}, *nerr.E) {
 		return info, nerr.Translate(err).Addf("failed to get cpu info")
 	}
 
-	info["hardware"] = cpuState
+	info.Hardware = cpuState
 
 	// get percent usage information per cpu
-	usage := make(map[string]float64)
-	info["usage"] = usage
+	info.Usage = make(map[string]float64)
 
 	percentages, err := cpu.Percent(0, true)
 	if err != nil {
@@ -59,7 +67,7 @@ func CPUInfo() (map[string]interface{}, *nerr.E) {
 	}
 
 	for i := range percentages {
-		usage[fmt.Sprintf("cpu%d", i)] = round(percentages[i], .01)
+		info.Usage[fmt.Sprintf("cpu%d", i)] = round(percentages[i], .01)
 	}
 
 	// get average usage
@@ -69,7 +77,7 @@ func CPUInfo() (map[string]interface{}, *nerr.E) {
 	}
 
 	if len(avgPercent) == 1 {
-		usage["avg"] = round(avgPercent[0], .01)
+		info.Usage["avg"] = round(avgPercent[0], .01)
 	}
 
 	// get load average metrics
@@ -78,15 +86,16 @@ func CPUInfo() (map[string]interface{}, *nerr.E) {
 		return info, nerr.Translate(err).Addf("failed to get load avg info")
 	}
 
-	info["avg1min"] = loadAvg.Load1
-	info["avg5min"] = loadAvg.Load5
+	info.LoadAvg1Min = loadAvg.Load1
+	info.LoadAvg5Min = loadAvg.Load5
+	info.LoadAvg15Min = loadAvg.Load15
 
 	return info, nil
 }
 
 // MemoryInfo .
-func MemoryInfo() (map[string]interface{}, *nerr.E) {
-	info := make(map[string]interface{})
+func MemoryInfo() (Memory, *nerr.E) {
+	var info Memory
 
 	vMem, err := mem.VirtualMemory()
 	if err != nil {
@@ -94,7 +103,7 @@ func MemoryInfo() (map[string]interface{}, *nerr.E) {
 	}
 
 	vMem.UsedPercent = round(vMem.UsedPercent, .01)
-	info["virtual"] = vMem
+	info.Virtual = vMem
 
 	sMem, err := mem.SwapMemory()
 	if err != nil {
@@ -102,34 +111,49 @@ func MemoryInfo() (map[string]interface{}, *nerr.E) {
 	}
 
 	sMem.UsedPercent = round(sMem.UsedPercent, .01)
-	info["swap"] = sMem
+	info.Swap = sMem
 
 	return info, nil
 }
 
 // HostInfo .
-func HostInfo() (map[string]interface{}, *nerr.E) {
-	info := make(map[string]interface{})
+func HostInfo() (Host, *nerr.E) {
+	var info Host
 
 	stat, err := host.Info()
 	if err != nil {
 		return info, nerr.Translate(err).Addf("failed to get host info")
 	}
 
-	info["os"] = stat
+	info.OS = stat
 
 	users, err := host.Users()
 	if err != nil {
 		return info, nerr.Translate(err).Addf("failed to get host info")
 	}
 
-	info["users"] = users
+	info.Users = users
 
+	temps, terr := Temperatures()
+	if terr != nil {
+		return info, terr.Addf("failed to get host info")
+	}
+
+	info.Temperature = temps
+
+	return info, nil
+}
+
+// Temperatures returns the temperature (in celsius) of each thermal zone, keyed by the type of zone
+func Temperatures() (map[string]float64, *nerr.E) {
 	temps := make(map[string]float64)
 	count := make(map[string]int)
-	info["temperature"] = temps
 
 	filepath.Walk(temperatureRootPath, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
 		if info.Mode()&os.ModeSymlink == os.ModeSymlink && strings.Contains(path, "thermal_") {
 			// get type
 			ttype, err := ioutil.ReadFile(path + "/type")
@@ -157,150 +181,28 @@ func HostInfo() (map[string]interface{}, *nerr.E) {
 		return nil
 	})
 
-	return info, nil
+	return temps, nil
 }
 
-// DiskInfo .
-func DiskInfo() (map[string]interface{}, *nerr.E) {
-	info := make(map[string]interface{})
-
-	usage, err := disk.Usage("/")
-	if err != nil {
-		return info, nerr.Translate(err).Addf("failed to get disk info")
-	}
-
-	usage.UsedPercent = round(usage.UsedPercent, .01)
-	info["usage"] = usage
-
-	ioCounters, err := disk.IOCounters("sda", "mmcblk0")
-	if err != nil {
-		return info, nerr.Translate(err).Addf("failed to get disk info")
-	}
-
-	info["io-counters"] = ioCounters
-
-	return info, nil
+// Network is information about the network interfaces
+type Network struct {
+	Interfaces []net.Interface `json:"interfaces,omitempty"`
 }
 
 // NetworkInfo .
-func NetworkInfo() (map[string]interface{}, *nerr.E) {
-	info := make(map[string]interface{})
+func NetworkInfo() (Network, *nerr.E) {
+	var info Network
 
 	interfaces, err := net.Interfaces()
 	if err != nil {
 		return info, nerr.Translate(err).Addf("failed to get network info")
 	}
 
-	info["interfaces"] = interfaces
+	info.Interfaces = interfaces
 
 	return info, nil
 }
 
-// DockerInfo .
-func DockerInfo() (map[string]interface{}, *nerr.E) {
-	info := make(map[string]interface{})
-
-	stats, err := docker.GetDockerStat()
-	if err != nil {
-		return info, nerr.Translate(err).Addf("failed to get docker info")
-	}
-
-	info["stats"] = stats
-
-	//add section getting the number of running docker containers
-	ctx := context.Background()
-	cli, err := client.NewEnvClient()
-	if err != nil {
-		return info, nerr.Translate(err).Addf("failed to get docker info")
-	}
-	cli.NegotiateAPIVersion(ctx)
-
-	containers, err := cli.ContainerList(context.Background(), types.ContainerListOptions{})
-	if err != nil {
-		return info, nerr.Translate(err).Addf("failed to get docker info")
-	}
-
-	info["docker-containers"] = len(containers)
-
-	return info, nil
-}
-
-// ProcsInfo .
-func ProcsInfo() (map[string]interface{}, *nerr.E) {
-	avgProcsInit.Do(startWatchingUSleep)
-	info := make(map[string]interface{})
-
-	procs, err := process.Processes()
-	if err != nil {
-		return info, nerr.Translate(err).Addf("failed to get processes info")
-	}
-
-	bad := []string{}
-
-	for _, p := range procs {
-		status, err := p.Status()
-		if err != nil {
-			continue
-		}
-
-		if status == "D" {
-			name, err := p.Name()
-			if err != nil {
-				name = fmt.Sprintf("unable to get name: %s", name)
-			}
-
-			bad = append(bad, name)
-		}
-	}
-
-	info["cur-procs-u-sleep"] = bad
-	info["avg-procs-u-sleep"] = avgProcsInUSleep
-
-	return info, nil
-}
-
-// constantly measure the number of processes that are in sleep and get an average
-func startWatchingUSleep() {
-	avgProcsInUSleep = 0
-
-	checkTicker := time.NewTicker(uSleepCheckInterval)
-	resetTicker := time.NewTicker(uSleepResetInterval)
-
-	go func() {
-		defer checkTicker.Stop()
-		defer resetTicker.Stop()
-
-		for {
-			select {
-			case <-checkTicker.C:
-				procs, err := process.Processes()
-				if err != nil {
-					log.L.Warnf("failed to get running processes: %s", err)
-					continue
-				}
-
-				count := 0
-
-				for _, p := range procs {
-					status, err := p.Status()
-					if err != nil {
-						continue
-					}
-
-					if status == "D" {
-						count++
-					}
-				}
-
-				avgProcsInUSleep = (avgProcsInUSleep + float64(count)) / 2
-				avgProcsInUSleep = round(avgProcsInUSleep, .05)
-			case <-resetTicker.C:
-				avgProcsInUSleep = 0
-			}
-		}
-	}()
-}
-
 func round(x, unit float64) float64 {
 	return math.Round(x/unit) * unit
 }
@@ -8,10 +8,17 @@ import (
 	"golang.org/x/sys/unix"
 )
 
-// Reboot reboots the device.
+// Sync flushes filesystem buffers to disk.
+func Sync() {
+	unix.Sync()
+}
+
+// Reboot syncs the filesystems and reboots the device.
 func Reboot() *nerr.E {
 	log.L.Infof("*!!* REBOOTING DEVICE NOW *!!*")
 
+	Sync()
+
 	err := unix.Reboot(unix.LINUX_REBOOT_CMD_RESTART)
 	if err != nil {
 		return nerr.Translate(err).Addf("failed to reboot device")
@@ -7,6 +7,10 @@ import (
 	"github.com/byuoitav/common/nerr"
 )
 
+// Sync flushes filesystem buffers to disk.
+func Sync() {
+}
+
 // Reboot reboots the device.
 func Reboot() *nerr.E {
 	log.L.Infof("*!!* REBOOTING DEVICE NOW *!!*")
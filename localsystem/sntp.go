@@ -0,0 +1,127 @@
+package localsystem
+
+import (
+	"context"
+	"encoding/binary"
+	"net"
+	"time"
+
+	"github.com/byuoitav/common/nerr"
+)
+
+const (
+	sntpTimeout = 5 * time.Second
+
+	// seconds between the ntp epoch (1900) and the unix epoch (1970)
+	ntpEpochOffset = 2208988800
+)
+
+// SNTPResult is the result of querying a time server
+type SNTPResult struct {
+	Server  string `json:"server"`
+	Stratum int    `json:"stratum,omitempty"`
+
+	// Offset is how far the clock is behind the server (negative if it's ahead)
+	Offset string `json:"offset"`
+	RTT    string `json:"rtt"`
+	Error  string `json:"error,omitempty"`
+
+	offset time.Duration
+}
+
+// OffsetDuration returns how far the clock is behind the server
+func (r SNTPResult) OffsetDuration() time.Duration {
+	return r.offset
+}
+
+// QuerySNTP asks server (host or host:port) for the time, and compares it with the clock
+func QuerySNTP(ctx context.Context, server string) SNTPResult {
+	res := SNTPResult{
+		Server: server,
+	}
+
+	offset, rtt, stratum, err := querySNTP(ctx, server)
+	if err != nil {
+		res.Error = err.Error()
+		return res
+	}
+
+	res.Stratum = stratum
+	res.Offset = offset.String()
+	res.RTT = rtt.String()
+	res.offset = offset
+	return res
+}
+
+func querySNTP(ctx context.Context, server string) (time.Duration, time.Duration, int, *nerr.E) {
+	ctx, cancel := context.WithTimeout(ctx, sntpTimeout)
+	defer cancel()
+
+	addr := server
+	if _, _, err := net.SplitHostPort(addr); err != nil {
+		addr = net.JoinHostPort(addr, "123")
+	}
+
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "udp", addr)
+	if err != nil {
+		return 0, 0, 0, nerr.Translate(err).Addf("unable to connect to %s", server)
+	}
+	defer conn.Close()
+
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+
+	// leap indicator 0, version 4, mode 3 (client)
+	req := make([]byte, 48)
+	req[0] = 0<<6 | 4<<3 | 3
+
+	sent := time.Now()
+	binary.BigEndian.PutUint64(req[40:], toNTPTime(sent))
+
+	if _, err := conn.Write(req); err != nil {
+		return 0, 0, 0, nerr.Translate(err).Addf("unable to query %s", server)
+	}
+
+	resp := make([]byte, 48)
+	n, err := conn.Read(resp)
+	received := time.Now()
+
+	switch {
+	case err != nil:
+		return 0, 0, 0, nerr.Translate(err).Addf("no response from %s", server)
+	case n < 48:
+		return 0, 0, 0, nerr.Createf("error", "short response from %s", server)
+	case binary.BigEndian.Uint64(resp[24:]) != toNTPTime(sent):
+		return 0, 0, 0, nerr.Createf("error", "response from %s doesn't match request", server)
+	}
+
+	stratum := int(resp[1])
+	if resp[0]>>6 == 3 || stratum == 0 || stratum >= 16 {
+		return 0, 0, stratum, nerr.Createf("error", "%s isn't synchronized (stratum %d)", server, stratum)
+	}
+
+	serverReceived := fromNTPTime(binary.BigEndian.Uint64(resp[32:]))
+	serverSent := fromNTPTime(binary.BigEndian.Uint64(resp[40:]))
+
+	offset := (serverReceived.Sub(sent) + serverSent.Sub(received)) / 2
+	rtt := received.Sub(sent) - serverSent.Sub(serverReceived)
+
+	return offset, rtt, stratum, nil
+}
+
+func toNTPTime(t time.Time) uint64 {
+	nsec := uint64(t.Sub(time.Unix(-ntpEpochOffset, 0)))
+	sec := nsec / uint64(time.Second)
+	frac := (nsec % uint64(time.Second)) << 32 / uint64(time.Second)
+
+	return sec<<32 | frac
+}
+
+func fromNTPTime(t uint64) time.Time {
+	sec := int64(t >> 32)
+	nsec := int64((t & 0xffffffff) * uint64(time.Second) >> 32)
+
+	return time.Unix(sec-ntpEpochOffset, nsec)
+}
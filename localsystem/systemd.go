@@ -0,0 +1,50 @@
+package localsystem
+
+import (
+	"context"
+	"os/exec"
+	"strconv"
+	"time"
+
+	"github.com/byuoitav/common/nerr"
+)
+
+const systemdTimestampLayout = "Mon 2006-01-02 15:04:05 MST"
+
+// Unit is the state of a systemd unit
+type Unit struct {
+	ActiveState  string    `json:"active-state"`
+	SubState     string    `json:"sub-state,omitempty"`
+	MainPID      int32     `json:"main-pid,omitempty"`
+	Restarts     int       `json:"restarts"`
+	ControlGroup string    `json:"control-group,omitempty"`
+	Since        time.Time `json:"since,omitempty"`
+}
+
+// UnitStatus returns the state of a systemd unit
+func UnitStatus(ctx context.Context, name string) (Unit, *nerr.E) {
+	var unit Unit
+
+	out, err := exec.CommandContext(ctx, "systemctl", "show", name, "--property=ActiveState,SubState,MainPID,NRestarts,ControlGroup,ActiveEnterTimestamp").Output()
+	if err != nil {
+		return unit, nerr.Translate(err).Addf("failed to get status of unit %s", name)
+	}
+
+	props := properties(string(out))
+
+	unit.ActiveState = props["ActiveState"]
+	unit.SubState = props["SubState"]
+	unit.ControlGroup = props["ControlGroup"]
+	unit.Restarts, _ = strconv.Atoi(props["NRestarts"])
+
+	if pid, err := strconv.ParseInt(props["MainPID"], 10, 32); err == nil {
+		unit.MainPID = int32(pid)
+	}
+
+	// systemd prints the local zone abbreviation, which time.Parse would treat as a zone with no offset
+	if t, err := time.ParseInLocation(systemdTimestampLayout, props["ActiveEnterTimestamp"], time.Local); err == nil {
+		unit.Since = t
+	}
+
+	return unit, nil
+}
@@ -0,0 +1,230 @@
+package localsystem
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/byuoitav/common/nerr"
+)
+
+const (
+	timesyncdSyncedPath = "/run/systemd/timesync/synchronized"
+)
+
+// TimeSync is the state of the clock's synchronization
+type TimeSync struct {
+	// Source is the daemon keeping the clock in sync (chrony, timesyncd, ntpd, or none)
+	Source       string    `json:"source"`
+	Synchronized bool      `json:"synchronized"`
+	Server       string    `json:"server,omitempty"`
+	Stratum      int       `json:"stratum,omitempty"`
+	LastSync     time.Time `json:"last-sync,omitempty"`
+
+	// Offset is how far the clock is from the server, in seconds. it's only reported by chrony and ntpd
+	Offset *float64 `json:"offset,omitempty"`
+}
+
+// TimeCheck is the clock's synchronization, compared with time servers
+type TimeCheck struct {
+	Timestamp time.Time    `json:"timestamp"`
+	Status    TimeSync     `json:"status"`
+	Servers   []SNTPResult `json:"servers,omitempty"`
+}
+
+var (
+	clockSynced      bool
+	clockSyncChecked bool
+	clockSyncMu      sync.RWMutex
+)
+
+// ClockSynchronized returns whether the clock was synchronized the last time TimeSyncInfo was called.
+// known is false if it hasn't been checked yet
+func ClockSynchronized() (synced bool, known bool) {
+	clockSyncMu.RLock()
+	defer clockSyncMu.RUnlock()
+
+	return clockSynced, clockSyncChecked
+}
+
+// SetClockSynchronized records whether the clock is synchronized, for ClockSynchronized
+func SetClockSynchronized(synced bool) {
+	clockSyncMu.Lock()
+	defer clockSyncMu.Unlock()
+
+	clockSynced = synced
+	clockSyncChecked = true
+}
+
+// TimeSyncInfo asks chrony, systemd-timesyncd, or ntpd (whichever is running) about the clock's synchronization
+func TimeSyncInfo(ctx context.Context) (TimeSync, *nerr.E) {
+	var info TimeSync
+	var err *nerr.E
+
+	switch {
+	case unitActive(ctx, "chrony") || unitActive(ctx, "chronyd"):
+		info, err = chronyInfo(ctx)
+	case unitActive(ctx, "systemd-timesyncd"):
+		info, err = timesyncdInfo(ctx)
+	case unitActive(ctx, "ntp") || unitActive(ctx, "ntpd"):
+		info, err = ntpdInfo(ctx)
+	default:
+		info = TimeSync{Source: "none"}
+		info.Synchronized, err = ntpSynchronized(ctx)
+	}
+
+	if err != nil {
+		return info, err.Addf("failed to get time sync info")
+	}
+
+	SetClockSynchronized(info.Synchronized)
+	return info, nil
+}
+
+// CheckTime gets the clock's synchronization status, and queries each of servers for its offset
+func CheckTime(ctx context.Context, servers []string) (TimeCheck, *nerr.E) {
+	check := TimeCheck{
+		Timestamp: time.Now(),
+		Servers:   make([]SNTPResult, len(servers)),
+	}
+
+	var wg sync.WaitGroup
+	for i := range servers {
+		wg.Add(1)
+
+		go func(i int) {
+			defer wg.Done()
+			check.Servers[i] = QuerySNTP(ctx, servers[i])
+		}(i)
+	}
+
+	var err *nerr.E
+	check.Status, err = TimeSyncInfo(ctx)
+
+	wg.Wait()
+	return check, err
+}
+
+func chronyInfo(ctx context.Context) (TimeSync, *nerr.E) {
+	info := TimeSync{Source: "chrony"}
+
+	out, err := exec.CommandContext(ctx, "chronyc", "-c", "tracking").Output()
+	if err != nil {
+		return info, nerr.Translate(err).Addf("failed to get chrony tracking")
+	}
+
+	// ref id, ref name, stratum, ref time, system time offset, last offset, rms offset, frequency,
+	// residual frequency, skew, root delay, root dispersion, update interval, leap status
+	fields := strings.Split(strings.TrimSpace(string(out)), ",")
+	if len(fields) < 14 {
+		return info, nerr.Createf("error", "unexpected chrony tracking output: %s", out)
+	}
+
+	info.Server = fields[1]
+	info.Stratum, _ = strconv.Atoi(fields[2])
+
+	if secs, err := strconv.ParseFloat(fields[3], 64); err == nil && secs > 0 {
+		info.LastSync = time.Unix(0, int64(secs*float64(time.Second)))
+	}
+
+	// chrony reports how far ahead of ntp time the clock is
+	if offset, err := strconv.ParseFloat(fields[4], 64); err == nil {
+		offset = round(-offset, .000001)
+		info.Offset = &offset
+	}
+
+	info.Synchronized = fields[13] != "Not synchronised" && info.Stratum > 0 && info.Stratum < 16
+	return info, nil
+}
+
+func timesyncdInfo(ctx context.Context) (TimeSync, *nerr.E) {
+	info := TimeSync{Source: "timesyncd"}
+
+	var err *nerr.E
+	info.Synchronized, err = ntpSynchronized(ctx)
+	if err != nil {
+		return info, err
+	}
+
+	// timesyncd touches this file each time it syncs
+	if stat, err := os.Stat(timesyncdSyncedPath); err == nil {
+		info.LastSync = stat.ModTime()
+	}
+
+	// only newer versions of timedatectl have show-timesync
+	if out, err := exec.CommandContext(ctx, "timedatectl", "show-timesync").Output(); err == nil {
+		props := properties(string(out))
+		info.Server = props["ServerName"]
+
+		msg := props["NTPMessage"]
+		if i := strings.Index(msg, "Stratum="); i >= 0 {
+			fields := strings.FieldsFunc(msg[i+len("Stratum="):], func(r rune) bool {
+				return r == ',' || r == ' ' || r == '}'
+			})
+
+			if len(fields) > 0 {
+				info.Stratum, _ = strconv.Atoi(fields[0])
+			}
+		}
+	}
+
+	return info, nil
+}
+
+func ntpdInfo(ctx context.Context) (TimeSync, *nerr.E) {
+	info := TimeSync{Source: "ntpd"}
+
+	out, err := exec.CommandContext(ctx, "ntpq", "-c", "rv 0 stratum,offset,refid,leap").Output()
+	if err != nil {
+		return info, nerr.Translate(err).Addf("failed to get ntpd status")
+	}
+
+	props := make(map[string]string)
+	for _, field := range strings.Split(strings.Replace(string(out), "\n", ",", -1), ",") {
+		split := strings.SplitN(strings.TrimSpace(field), "=", 2)
+		if len(split) == 2 {
+			props[split[0]] = strings.Trim(split[1], `"`)
+		}
+	}
+
+	info.Server = props["refid"]
+	info.Stratum, _ = strconv.Atoi(props["stratum"])
+
+	// ntpd reports the offset in milliseconds
+	if ms, err := strconv.ParseFloat(props["offset"], 64); err == nil {
+		offset := round(ms/1000, .000001)
+		info.Offset = &offset
+	}
+
+	info.Synchronized = props["leap"] != "11" && props["leap"] != "" && info.Stratum > 0 && info.Stratum < 16
+	return info, nil
+}
+
+func ntpSynchronized(ctx context.Context) (bool, *nerr.E) {
+	out, err := exec.CommandContext(ctx, "timedatectl", "show", "--property=NTPSynchronized", "--value").Output()
+	if err != nil {
+		return false, nerr.Translate(err).Addf("failed to check if the clock is synchronized")
+	}
+
+	return strings.TrimSpace(string(out)) == "yes", nil
+}
+
+func unitActive(ctx context.Context, unit string) bool {
+	return exec.CommandContext(ctx, "systemctl", "is-active", "--quiet", unit).Run() == nil
+}
+
+func properties(s string) map[string]string {
+	props := make(map[string]string)
+	for _, line := range strings.Split(s, "\n") {
+		split := strings.SplitN(line, "=", 2)
+		if len(split) == 2 {
+			props[split[0]] = split[1]
+		}
+	}
+
+	return props
+}
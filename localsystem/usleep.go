@@ -0,0 +1,297 @@
+package localsystem
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/byuoitav/common/log"
+	"github.com/byuoitav/common/nerr"
+	"github.com/shirou/gopsutil/process"
+)
+
+const (
+	defaultUSleepCheckInterval = 3 * time.Second
+
+	// the number of longest blocked processes to report
+	longestBlockedCount = 5
+)
+
+var defaultUSleepWindows = []time.Duration{time.Minute, 5 * time.Minute, 15 * time.Minute}
+
+// USleepConfig controls how the number of processes in uninterruptible sleep is averaged
+type USleepConfig struct {
+	// CheckInterval is how often processes are checked. defaults to 3s
+	CheckInterval string `json:"check-interval,omitempty"`
+
+	// Windows are the windows to average over, like the load average. defaults to 1m, 5m, and 15m
+	Windows []string `json:"windows,omitempty"`
+}
+
+// Processes is information about the running processes
+type Processes struct {
+	// InUSleep is the name of each process currently in uninterruptible sleep
+	InUSleep []string `json:"cur-procs-u-sleep"`
+
+	// AvgInUSleep is the average number of processes in uninterruptible sleep over the shortest window
+	AvgInUSleep float64 `json:"avg-procs-u-sleep"`
+
+	// AvgsInUSleep is the average number of processes in uninterruptible sleep over each window
+	AvgsInUSleep map[string]float64 `json:"avgs-procs-u-sleep,omitempty"`
+
+	// LongestBlocked are the processes that have been in uninterruptible sleep the longest
+	LongestBlocked []BlockedProcess `json:"longest-blocked,omitempty"`
+}
+
+// BlockedProcess is a process that has been in uninterruptible sleep since it was first seen in that state
+type BlockedProcess struct {
+	PID        int32     `json:"pid"`
+	Name       string    `json:"name"`
+	Since      time.Time `json:"since"`
+	BlockedFor string    `json:"blocked-for"`
+}
+
+// uSleepTracker keeps an exponentially weighted moving average of the number of processes in uninterruptible sleep
+type uSleepTracker struct {
+	interval time.Duration
+	windows  []time.Duration
+	averages []float64
+	primed   bool
+
+	blocked map[int32]BlockedProcess
+
+	restart chan struct{}
+	mu      sync.RWMutex
+}
+
+var (
+	uSleepOnce sync.Once
+	uSleep     = &uSleepTracker{
+		interval: defaultUSleepCheckInterval,
+		windows:  defaultUSleepWindows,
+		averages: make([]float64, len(defaultUSleepWindows)),
+		blocked:  make(map[int32]BlockedProcess),
+		restart:  make(chan struct{}, 1),
+	}
+)
+
+// SetUSleepConfig changes how often processes are checked and which windows they are averaged over
+func SetUSleepConfig(config USleepConfig) *nerr.E {
+	interval := defaultUSleepCheckInterval
+	if len(config.CheckInterval) > 0 {
+		d, err := time.ParseDuration(config.CheckInterval)
+		if err != nil || d <= 0 {
+			return nerr.Createf("invalid", "invalid uninterruptible sleep check interval '%s'", config.CheckInterval)
+		}
+
+		interval = d
+	}
+
+	windows := defaultUSleepWindows
+	if len(config.Windows) > 0 {
+		windows = nil
+
+		for _, w := range config.Windows {
+			d, err := time.ParseDuration(w)
+			if err != nil || d <= 0 {
+				return nerr.Createf("invalid", "invalid uninterruptible sleep window '%s'", w)
+			}
+
+			windows = append(windows, d)
+		}
+
+		sort.Slice(windows, func(i, j int) bool { return windows[i] < windows[j] })
+	}
+
+	uSleep.mu.Lock()
+	defer uSleep.mu.Unlock()
+
+	if interval == uSleep.interval && durationsEqual(windows, uSleep.windows) {
+		return nil
+	}
+
+	if !durationsEqual(windows, uSleep.windows) {
+		uSleep.windows = windows
+		uSleep.averages = make([]float64, len(windows))
+		uSleep.primed = false
+	}
+
+	uSleep.interval = interval
+
+	// let the tracker know to pick up the new interval
+	select {
+	case uSleep.restart <- struct{}{}:
+	default:
+	}
+
+	return nil
+}
+
+// ProcsInfo .
+func ProcsInfo() (Processes, *nerr.E) {
+	uSleepOnce.Do(func() {
+		go uSleep.run()
+	})
+
+	info := Processes{
+		InUSleep: []string{},
+	}
+
+	procs, err := process.Processes()
+	if err != nil {
+		return info, nerr.Translate(err).Addf("failed to get processes info")
+	}
+
+	for _, p := range procs {
+		status, err := p.Status()
+		if err != nil {
+			continue
+		}
+
+		if status == "D" {
+			name, err := p.Name()
+			if err != nil {
+				name = fmt.Sprintf("unable to get name: %s", err)
+			}
+
+			info.InUSleep = append(info.InUSleep, name)
+		}
+	}
+
+	uSleep.mu.RLock()
+	defer uSleep.mu.RUnlock()
+
+	info.AvgsInUSleep = make(map[string]float64)
+	for i, w := range uSleep.windows {
+		info.AvgsInUSleep[windowName(w)] = round(uSleep.averages[i], .01)
+	}
+
+	if len(uSleep.averages) > 0 {
+		info.AvgInUSleep = round(uSleep.averages[0], .01)
+	}
+
+	for _, b := range uSleep.blocked {
+		b.BlockedFor = time.Since(b.Since).Truncate(time.Second).String()
+		info.LongestBlocked = append(info.LongestBlocked, b)
+	}
+
+	sort.Slice(info.LongestBlocked, func(i, j int) bool {
+		return info.LongestBlocked[i].Since.Before(info.LongestBlocked[j].Since)
+	})
+
+	if len(info.LongestBlocked) > longestBlockedCount {
+		info.LongestBlocked = info.LongestBlocked[:longestBlockedCount]
+	}
+
+	return info, nil
+}
+
+// run constantly measures the number of processes in uninterruptible sleep
+func (t *uSleepTracker) run() {
+	t.mu.RLock()
+	ticker := time.NewTicker(t.interval)
+	t.mu.RUnlock()
+
+	defer func() {
+		ticker.Stop()
+	}()
+
+	for {
+		select {
+		case <-ticker.C:
+			t.check()
+		case <-t.restart:
+			ticker.Stop()
+
+			t.mu.RLock()
+			ticker = time.NewTicker(t.interval)
+			t.mu.RUnlock()
+		}
+	}
+}
+
+func (t *uSleepTracker) check() {
+	procs, err := process.Processes()
+	if err != nil {
+		log.L.Warnf("failed to get running processes: %s", err)
+		return
+	}
+
+	now := time.Now()
+	blocked := make(map[int32]BlockedProcess)
+
+	t.mu.RLock()
+	for _, p := range procs {
+		status, err := p.Status()
+		if err != nil || status != "D" {
+			continue
+		}
+
+		// keep when it was first seen blocked if it was blocked last time too
+		if prev, ok := t.blocked[p.Pid]; ok {
+			blocked[p.Pid] = prev
+			continue
+		}
+
+		name, err := p.Name()
+		if err != nil {
+			name = fmt.Sprintf("unable to get name: %s", err)
+		}
+
+		blocked[p.Pid] = BlockedProcess{
+			PID:   p.Pid,
+			Name:  name,
+			Since: now,
+		}
+	}
+	t.mu.RUnlock()
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.blocked = blocked
+	count := float64(len(blocked))
+
+	// start the averages at the first count instead of easing up from 0
+	if !t.primed {
+		for i := range t.averages {
+			t.averages[i] = count
+		}
+
+		t.primed = true
+		return
+	}
+
+	for i, w := range t.windows {
+		alpha := 1 - math.Exp(-t.interval.Seconds()/w.Seconds())
+		t.averages[i] += alpha * (count - t.averages[i])
+	}
+}
+
+// windowName formats a window like the load average (ie, 1m, 15m, 1h)
+func windowName(d time.Duration) string {
+	switch {
+	case d%time.Hour == 0:
+		return fmt.Sprintf("%dh", d/time.Hour)
+	case d%time.Minute == 0:
+		return fmt.Sprintf("%dm", d/time.Minute)
+	default:
+		return d.String()
+	}
+}
+
+func durationsEqual(a, b []time.Duration) bool {
+	if len(a) != len(b) {
+		return false
+	}
+
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+
+	return true
+}
@@ -1,13 +1,23 @@
 package messenger
 
 import (
+	"context"
+	"net"
+	"net/url"
 	"sync"
 
 	mess "github.com/byuoitav/central-event-system/messenger"
 	"github.com/byuoitav/common/nerr"
 	"github.com/byuoitav/common/v2/events"
+	"github.com/byuoitav/device-monitoring/localsystem"
 )
 
+// hubPort is the port the hub listens on, if the hub address doesn't include one
+const hubPort = "7100"
+
+// UnsyncedClockTag is added to events sent while the clock isn't synchronized, since their timestamps can't be trusted
+const UnsyncedClockTag = "unsynced-clock"
+
 // Messenger .
 type Messenger struct {
 	*mess.Messenger
@@ -15,6 +25,8 @@ type Messenger struct {
 	registered   []chan events.Event
 	registeredMu sync.Mutex
 	once         sync.Once
+
+	hubAddress string
 }
 
 // BuildMessenger .
@@ -22,7 +34,12 @@ func BuildMessenger(hubAddress, connectionType string, bufferSize int) (*Messeng
 	msgr, err := mess.BuildMessenger(hubAddress, connectionType, bufferSize)
 
 	m := &Messenger{
-		Messenger: msgr,
+		Messenger:  msgr,
+		hubAddress: hubAddress,
+	}
+
+	if msgr == nil {
+		return m, err
 	}
 
 	go func() {
@@ -46,6 +63,37 @@ func BuildMessenger(hubAddress, connectionType string, bufferSize int) (*Messeng
 	return m, err
 }
 
+// Reachable checks that the hub can be connected to. it doesn't depend on any events being sent or received,
+// so a quiet room doesn't look like a lost connection
+func (m *Messenger) Reachable(ctx context.Context) error {
+	addr := m.hubAddress
+	if u, err := url.Parse(addr); err == nil && len(u.Host) > 0 {
+		addr = u.Host
+	}
+
+	if _, _, err := net.SplitHostPort(addr); err != nil {
+		addr = net.JoinHostPort(addr, hubPort)
+	}
+
+	var dialer net.Dialer
+
+	conn, err := dialer.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return err
+	}
+
+	return conn.Close()
+}
+
+// SendEvent sends event to the hub, marking it if the clock isn't synchronized
+func (m *Messenger) SendEvent(event events.Event) {
+	if synced, known := localsystem.ClockSynchronized(); known && !synced {
+		event.AddToTags(UnsyncedClockTag)
+	}
+
+	m.Messenger.SendEvent(event)
+}
+
 // Register .
 func (m *Messenger) Register(ch chan events.Event) {
 	m.registeredMu.Lock()
@@ -0,0 +1,318 @@
+package metrics
+
+import (
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	namespace = "device_monitoring"
+)
+
+var (
+	pingRoundTrip = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "ping_round_trip_seconds",
+		Help:      "The average round trip time of the last pings sent to a device.",
+	}, []string{"device"})
+
+	pingLoss = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "ping_loss_ratio",
+		Help:      "The ratio of the last pings sent to a device that were lost.",
+	}, []string{"device"})
+
+	deviceAPIHealthy = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "device_api_healthy",
+		Help:      "Whether the last api health check of a device passed (1) or failed (0).",
+	}, []string{"device"})
+
+	serviceUp = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "service_up",
+		Help:      "Whether the last health check of the service passed (1) or failed (0).",
+	}, []string{"service"})
+
+	serviceUptime = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "service_uptime_ratio",
+		Help:      "The ratio of recent health checks of the service that passed.",
+	}, []string{"service"})
+
+	serviceResponseTime = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "service_response_seconds",
+		Help:      "How long the last health check of the service took to respond.",
+	}, []string{"service"})
+
+	serviceChecks = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "service_checks_total",
+		Help:      "The number of health checks run against the service.",
+	}, []string{"service", "result"})
+
+	cpuUsage = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "cpu_usage_percent",
+		Help:      "The percent usage of each cpu, and the average of all of them.",
+	}, []string{"cpu"})
+
+	loadAverage = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "load_average",
+		Help:      "The system load average.",
+	}, []string{"period"})
+
+	memoryUsage = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "memory_used_percent",
+		Help:      "The percent of virtual or swap memory in use.",
+	}, []string{"type"})
+
+	diskUsage = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "disk_used_percent",
+		Help:      "The percent of the disk in use.",
+	}, []string{"path"})
+
+	diskWrites = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "disk_writes",
+		Help:      "The number of writes to a disk since boot.",
+	}, []string{"disk"})
+
+	temperature = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "temperature_celsius",
+		Help:      "The temperature of each chip.",
+	}, []string{"chip"})
+
+	procsInUSleep = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "procs_in_uninterruptible_sleep",
+		Help:      "The moving average of the number of processes in uninterruptible sleep over each window.",
+	}, []string{"window"})
+
+	dockerContainers = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "docker_containers_running",
+		Help:      "The number of running docker containers.",
+	})
+
+	dnsLookupTime = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "dns_lookup_seconds",
+		Help:      "How long the last lookup of a name took against each nameserver.",
+	}, []string{"name", "nameserver"})
+
+	dnsLookupOK = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "dns_lookup_ok",
+		Help:      "Whether the last lookup of a name against each nameserver returned the expected answer (1) or not (0).",
+	}, []string{"name", "nameserver"})
+
+	clockSynchronized = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "clock_synchronized",
+		Help:      "Whether the clock is synchronized (1) or not (0).",
+	})
+
+	clockOffset = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "clock_offset_seconds",
+		Help:      "How far the clock is behind each time server.",
+	}, []string{"server"})
+
+	containerRunning = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "docker_container_running",
+		Help:      "Whether or not each docker container is running.",
+	}, []string{"container"})
+
+	containerRestarts = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "docker_container_restarts",
+		Help:      "The number of times docker has restarted each container.",
+	}, []string{"container"})
+
+	containerCPUUsage = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "docker_container_cpu_usage_percent",
+		Help:      "The cpu usage of each running docker container.",
+	}, []string{"container"})
+
+	containerMemoryUsage = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "docker_container_memory_usage_megabytes",
+		Help:      "The memory usage of each running docker container.",
+	}, []string{"container"})
+
+	dividerConnected = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "divider_connected",
+		Help:      "Whether the divider sensor on a pin is connected (1) or disconnected (0).",
+	}, []string{"pin"})
+
+	actionRuns = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "action_runs_total",
+		Help:      "The number of times an action has run.",
+	}, []string{"action", "result"})
+
+	actionDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "action_duration_seconds",
+		Help:      "How long an action took to run.",
+		Buckets:   []float64{.05, .1, .25, .5, 1, 2.5, 5, 10, 30, 60},
+	}, []string{"action"})
+)
+
+func init() {
+	prometheus.MustRegister(
+		pingRoundTrip,
+		pingLoss,
+		deviceAPIHealthy,
+		serviceUp,
+		serviceUptime,
+		serviceResponseTime,
+		serviceChecks,
+		cpuUsage,
+		loadAverage,
+		memoryUsage,
+		diskUsage,
+		diskWrites,
+		temperature,
+		procsInUSleep,
+		dockerContainers,
+		containerRunning,
+		dnsLookupTime,
+		dnsLookupOK,
+		clockSynchronized,
+		clockOffset,
+		containerRestarts,
+		containerCPUUsage,
+		containerMemoryUsage,
+		dividerConnected,
+		actionRuns,
+		actionDuration,
+	)
+}
+
+// Ping records the result of pinging a device
+func Ping(device string, sent, lost int, roundTrip time.Duration) {
+	if sent > 0 {
+		pingLoss.WithLabelValues(device).Set(float64(lost) / float64(sent))
+	} else {
+		pingLoss.WithLabelValues(device).Set(1)
+	}
+
+	pingRoundTrip.WithLabelValues(device).Set(roundTrip.Seconds())
+}
+
+// DeviceAPIHealth records the result of a device's api health check
+func DeviceAPIHealth(device string, healthy bool) {
+	deviceAPIHealthy.WithLabelValues(device).Set(boolToFloat(healthy))
+}
+
+// ServiceCheck records the result of a service health check, and the ratio of recent checks that have passed
+func ServiceCheck(service string, healthy bool, uptime float64, responseTime time.Duration) {
+	result := "success"
+	if !healthy {
+		result = "failure"
+	}
+
+	serviceUp.WithLabelValues(service).Set(boolToFloat(healthy))
+	serviceUptime.WithLabelValues(service).Set(uptime)
+	serviceResponseTime.WithLabelValues(service).Set(responseTime.Seconds())
+	serviceChecks.WithLabelValues(service, result).Inc()
+}
+
+// CPUUsage records the percent usage of a cpu
+func CPUUsage(cpu string, percent float64) {
+	cpuUsage.WithLabelValues(cpu).Set(percent)
+}
+
+// LoadAverage records the load average over a period (ie, "1m")
+func LoadAverage(period string, avg float64) {
+	loadAverage.WithLabelValues(period).Set(avg)
+}
+
+// MemoryUsage records the percent of virtual or swap memory in use
+func MemoryUsage(memType string, percent float64) {
+	memoryUsage.WithLabelValues(memType).Set(percent)
+}
+
+// DiskUsage records the percent of the disk mounted at path in use
+func DiskUsage(path string, percent float64) {
+	diskUsage.WithLabelValues(path).Set(percent)
+}
+
+// DiskWrites records the number of writes to a disk
+func DiskWrites(disk string, count uint64) {
+	diskWrites.WithLabelValues(disk).Set(float64(count))
+}
+
+// Temperature records the temperature of a chip
+func Temperature(chip string, celsius float64) {
+	temperature.WithLabelValues(chip).Set(celsius)
+}
+
+// ProcsInUSleep records the average number of processes in uninterruptible sleep over a window
+func ProcsInUSleep(window string, avg float64) {
+	procsInUSleep.WithLabelValues(window).Set(avg)
+}
+
+// DockerContainers records the number of running docker containers
+func DockerContainers(count int) {
+	dockerContainers.Set(float64(count))
+}
+
+// Container records the state and resource usage of a docker container
+func Container(name string, running bool, restarts int, cpuPercent, memoryMB float64) {
+	containerRunning.WithLabelValues(name).Set(boolToFloat(running))
+	containerRestarts.WithLabelValues(name).Set(float64(restarts))
+	containerCPUUsage.WithLabelValues(name).Set(cpuPercent)
+	containerMemoryUsage.WithLabelValues(name).Set(memoryMB)
+}
+
+// DNSLookup records how long a lookup took, and whether it returned the expected answer
+func DNSLookup(name, nameserver string, latency time.Duration, ok bool) {
+	dnsLookupTime.WithLabelValues(name, nameserver).Set(latency.Seconds())
+	dnsLookupOK.WithLabelValues(name, nameserver).Set(boolToFloat(ok))
+}
+
+// ClockSynchronized records whether the clock is synchronized
+func ClockSynchronized(synced bool) {
+	clockSynchronized.Set(boolToFloat(synced))
+}
+
+// ClockOffset records how far the clock is behind a time server
+func ClockOffset(server string, offset time.Duration) {
+	clockOffset.WithLabelValues(server).Set(offset.Seconds())
+}
+
+// DividerConnected records the state of the divider sensor on a pin
+func DividerConnected(pin string, connected bool) {
+	dividerConnected.WithLabelValues(pin).Set(boolToFloat(connected))
+}
+
+// ActionRun records that an action ran, how long it took, and whether or not it succeeded
+func ActionRun(action string, duration time.Duration, succeeded bool) {
+	result := "success"
+	if !succeeded {
+		result = "failure"
+	}
+
+	actionRuns.WithLabelValues(action, result).Inc()
+	actionDuration.WithLabelValues(action).Observe(duration.Seconds())
+}
+
+func boolToFloat(b bool) float64 {
+	if b {
+		return 1
+	}
+
+	return 0
+}
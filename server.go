@@ -2,32 +2,98 @@ package main
 
 import (
 	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
 	"net/http"
+	"os"
+	"path/filepath"
 	"strings"
+	"time"
 
 	"github.com/byuoitav/common"
+	"github.com/byuoitav/common/log"
+	"github.com/byuoitav/common/nerr"
 	"github.com/byuoitav/device-monitoring/actions"
+	"github.com/byuoitav/device-monitoring/audit"
+	"github.com/byuoitav/device-monitoring/auth"
 	"github.com/byuoitav/device-monitoring/handlers"
+	"github.com/byuoitav/device-monitoring/localsystem"
 	"github.com/byuoitav/device-monitoring/messenger"
+	"github.com/byuoitav/device-monitoring/watchdog"
 	"github.com/labstack/echo"
 	"github.com/labstack/echo/middleware"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"github.com/spf13/pflag"
 
 	_ "github.com/byuoitav/device-monitoring/actions/then"
 )
 
-var uiURL string
+var (
+	uiURL string
+
+	// scheme is https if the server has a tls certificate
+	scheme = "http"
+)
+
+const port = ":10000"
 
 func main() {
-	go actions.ActionManager().Start(context.TODO())
-	messenger.Get().Register(actions.ActionManager().EventStream)
+	var watchdogConfig watchdog.Config
+	var authConfig, auditLog, dataDir, tlsCert, tlsKey, clientCA string
+	var allowUnauthenticated bool
 
 	pflag.StringVar(&uiURL, "ui-url", "", "url to redirect to the ui")
+	pflag.StringVar(&watchdogConfig.Device, "watchdog-device", "", "hardware watchdog to feed while this service is healthy (ie, /dev/watchdog)")
+	pflag.DurationVar(&watchdogConfig.Grace, "watchdog-grace", time.Minute, "how long this service can be unhealthy before the watchdog stops being fed")
+	pflag.IntVar(&watchdogConfig.MaxResets, "watchdog-max-resets", 3, "the most times the hardware watchdog may reset the device in --watchdog-reset-window")
+	pflag.DurationVar(&watchdogConfig.ResetWindow, "watchdog-reset-window", 24*time.Hour, "the window --watchdog-max-resets is counted over")
+	pflag.StringVar(&authConfig, "auth-config", os.Getenv("AUTH_CONFIG"), "file with the api keys and client certificates allowed to call protected endpoints")
+	pflag.BoolVar(&allowUnauthenticated, "allow-unauthenticated", false, "allow anyone to call protected endpoints when --auth-config isn't given")
+	pflag.StringVar(&auditLog, "audit-log", audit.DefaultPath, "file to write privileged calls to. relative paths are in --data-dir")
+	pflag.StringVar(&dataDir, "data-dir", localsystem.DefaultDataDir, "absolute path of the directory to save state that has to survive a reboot in")
+	pflag.StringVar(&tlsCert, "tls-cert", "", "certificate to serve https with")
+	pflag.StringVar(&tlsKey, "tls-key", "", "key for --tls-cert")
+	pflag.StringVar(&clientCA, "client-ca", "", "ca used to verify client certificates (mTLS)")
 	pflag.Parse()
 	// subscribe to something?
 
+	audit.SetPath(auditLog)
+
+	if !filepath.IsAbs(dataDir) {
+		log.L.Fatalf("--data-dir must be an absolute path (got %q)", dataDir)
+	}
+
+	localsystem.SetDataDir(dataDir)
+
+	// the actions use the data dir, so they aren't started until the flags are parsed
+	go actions.ActionManager().Start(context.TODO())
+	messenger.Get().Register(actions.ActionManager().EventStream)
+
+	if len(authConfig) > 0 {
+		if err := auth.LoadConfig(authConfig); err != nil {
+			log.L.Fatalf("%s", err.Error())
+		}
+	} else if allowUnauthenticated {
+		auth.AllowUnauthenticated(true)
+		log.L.Warnf("no auth config was given and --allow-unauthenticated is set; protected endpoints are open to everyone")
+	} else {
+		log.L.Warnf("no auth config was given; protected endpoints will refuse every request")
+	}
+
+	tlsConfig, err := buildTLSConfig(tlsCert, tlsKey, clientCA)
+	if err != nil {
+		log.L.Fatalf("%s", err.Error())
+	}
+
+	if tlsConfig != nil {
+		scheme = "https"
+	}
+
+	startWatchdog(watchdogConfig)
+
 	// server
-	port := ":10000"
 	router := common.NewRouter()
 
 	// remove this eventually
@@ -55,9 +121,16 @@ func main() {
 	router.GET("/device/ip", handlers.GetIPAddress)
 	router.GET("/device/network", handlers.IsConnectedToInternet)
 	router.GET("/device/dhcp", handlers.GetDHCPState)
-	router.GET("/device/screenshot", handlers.GetScreenshot)
+	router.GET("/device/screenshot", handlers.GetScreenshot, auth.Require(auth.Read))
+	router.GET("/device/screen/stream", handlers.StreamScreen, auth.Require(auth.Read))
 	router.GET("/device/hardwareinfo", handlers.HardwareInfo)
-	router.PUT("/device/health", handlers.GetServiceHealth)
+	router.GET("/device/hardwareinfo/history", handlers.HardwareInfoHistory)
+	router.PUT("/device/health", handlers.GetServiceHealth, auth.Require(auth.Operate))
+	router.GET("/device/health", handlers.GetServiceHealthHistory)
+	router.GET("/device/time", handlers.GetTimeSync)
+	router.PUT("/device/dns", handlers.CheckDNS, auth.Require(auth.Read))
+	router.GET("/device/docker", handlers.GetContainers)
+	router.GET("/device/docker/:container/logs", handlers.GetContainerLogs, auth.Require(auth.Read))
 
 	// room info endpoints
 	router.GET("/room/ping", handlers.PingRoom)
@@ -68,16 +141,24 @@ func main() {
 	router.GET("/room/health", handlers.RoomHealth)
 
 	// action endpoints
-	router.PUT("/device/reboot", handlers.RebootPi)
-	router.PUT("/device/dhcp/:state", handlers.SetDHCPState)
-	router.POST("/event", handlers.SendEvent)
+	router.PUT("/device/reboot", handlers.RebootPi, auth.Require(auth.Operate))
+	router.DELETE("/device/reboot", handlers.CancelReboot, auth.Require(auth.Operate))
+	router.GET("/device/reboot", handlers.GetScheduledReboot)
+	router.GET("/device/watchdog", handlers.GetWatchdogStatus)
+	router.GET("/device/browser", handlers.GetBrowserStatus)
+	router.PUT("/device/dhcp/:state", handlers.SetDHCPState, auth.Require(auth.Admin))
+	router.PUT("/device/docker/:container/restart", handlers.RestartContainer, auth.Require(auth.Operate))
+	router.POST("/event", handlers.SendEvent, auth.Require(auth.Operate))
 
 	// divider sensors
 	router.GET("/divider/state", handlers.GetDividerState)
 	router.GET("/divider/preset/:hostname", handlers.PresetForHostname)
 
 	// flush dns cache
-	router.GET("/dns", handlers.FlushDNS)
+	router.POST("/dns", handlers.FlushDNS, auth.Require(auth.Operate))
+
+	// audit log of privileged calls
+	router.GET("/audit", handlers.GetAuditLog, auth.Require(auth.Read))
 
 	router.GET("/ui", redirectHandler)
 
@@ -91,16 +172,132 @@ func main() {
 		router.GET("/provisioning/id", handlers.GetProvisioningID)
 	*/
 
+	// prometheus metrics
+	router.GET("/metrics", echo.WrapHandler(promhttp.Handler()))
+
 	router.GET("/actions", actions.ActionManager().Info)
 	router.GET("/actions/trigger/:trigger", actions.ActionManager().Config.ActionsByTrigger)
 
 	server := http.Server{
 		Addr:           port,
 		MaxHeaderBytes: 1024 * 10,
+		TLSConfig:      tlsConfig,
 	}
 	router.StartServer(&server)
 }
 
+// startWatchdog feeds the hardware watchdog and systemd's watchdog (if either is enabled)
+// as long as the action manager, the messenger, and the http server are healthy. the messenger only affects systemd's watchdog
+func startWatchdog(config watchdog.Config) {
+	if _, ok := os.LookupEnv("NOTIFY_SOCKET"); !ok && len(config.Device) == 0 {
+		return
+	}
+
+	checks := []watchdog.Check{
+		{
+			Name: "action-manager",
+			Check: func(ctx context.Context) error {
+				stream := actions.ActionManager().EventStream
+				if len(stream) >= cap(stream)*9/10 {
+					return fmt.Errorf("event stream is backed up (%d/%d events)", len(stream), cap(stream))
+				}
+
+				return nil
+			},
+		},
+		{
+			Name: "messenger",
+			Check: func(ctx context.Context) error {
+				if messenger.Get() == nil || messenger.Get().Messenger == nil {
+					return fmt.Errorf("not connected to the event hub")
+				}
+
+				if err := messenger.Get().Reachable(ctx); err != nil {
+					return fmt.Errorf("unable to reach the event hub: %s", err)
+				}
+
+				return nil
+			},
+
+			// rebooting the device won't bring the hub back
+			SystemdOnly: true,
+		},
+		{
+			Name: "http-server",
+			Check: func(ctx context.Context) error {
+				req, err := http.NewRequest("GET", scheme+"://localhost"+port+"/device/id", nil)
+				if err != nil {
+					return err
+				}
+
+				// the certificate won't be for localhost
+				client := &http.Client{
+					Transport: &http.Transport{
+						TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
+					},
+				}
+
+				resp, err := client.Do(req.WithContext(ctx))
+				if err != nil {
+					return err
+				}
+				defer resp.Body.Close()
+
+				if resp.StatusCode/100 != 2 {
+					return fmt.Errorf("%v response from /device/id", resp.StatusCode)
+				}
+
+				return nil
+			},
+		},
+	}
+
+	go func() {
+		if err := watchdog.Run(context.TODO(), config, checks); err != nil {
+			log.L.Errorf("unable to start watchdog: %s", err.Error())
+		}
+	}()
+}
+
+// buildTLSConfig returns the tls config for the server, or nil if a certificate wasn't given.
+// if clientCA is set, clients may authenticate with a certificate signed by it.
+func buildTLSConfig(cert, key, clientCA string) (*tls.Config, *nerr.E) {
+	if len(cert) == 0 && len(key) == 0 {
+		if len(clientCA) > 0 {
+			return nil, nerr.Create("--client-ca requires --tls-cert and --tls-key", "invalid")
+		}
+
+		return nil, nil
+	}
+
+	pair, err := tls.LoadX509KeyPair(cert, key)
+	if err != nil {
+		return nil, nerr.Translate(err).Addf("unable to load tls certificate")
+	}
+
+	config := &tls.Config{
+		Certificates: []tls.Certificate{pair},
+	}
+
+	if len(clientCA) > 0 {
+		b, err := ioutil.ReadFile(clientCA)
+		if err != nil {
+			return nil, nerr.Translate(err).Addf("unable to load client ca")
+		}
+
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(b) {
+			return nil, nerr.Createf("invalid", "no certificates found in %s", clientCA)
+		}
+
+		// certificates are optional, so that callers can still use api keys
+		config.ClientCAs = pool
+		config.ClientAuth = tls.VerifyClientCertIfGiven
+	}
+
+	return config, nil
+}
+
 func redirectHandler(ctx echo.Context) error {
 	if uiURL != "" {
 		return ctx.Redirect(http.StatusTemporaryRedirect, "http://"+uiURL)
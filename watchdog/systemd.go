@@ -0,0 +1,54 @@
+package watchdog
+
+import (
+	"net"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/byuoitav/common/nerr"
+)
+
+// systemdWatchdog returns systemd's watchdog timeout for this service, and whether it's enabled
+func systemdWatchdog() (time.Duration, bool) {
+	if len(os.Getenv("NOTIFY_SOCKET")) == 0 {
+		return 0, false
+	}
+
+	// if WATCHDOG_PID is set, the watchdog is meant for that process
+	if pid := os.Getenv("WATCHDOG_PID"); len(pid) > 0 && pid != strconv.Itoa(os.Getpid()) {
+		return 0, false
+	}
+
+	usec, err := strconv.ParseInt(os.Getenv("WATCHDOG_USEC"), 10, 64)
+	if err != nil || usec <= 0 {
+		return 0, false
+	}
+
+	return time.Duration(usec) * time.Microsecond, true
+}
+
+// notify sends state to systemd (see sd_notify(3))
+func notify(state string) *nerr.E {
+	socket := os.Getenv("NOTIFY_SOCKET")
+	if len(socket) == 0 {
+		return nerr.Create("NOTIFY_SOCKET is not set", "invalid")
+	}
+
+	// abstract sockets start with @
+	if socket[0] == '@' {
+		socket = "\x00" + socket[1:]
+	}
+
+	conn, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: socket, Net: "unixgram"})
+	if err != nil {
+		return nerr.Translate(err).Addf("unable to connect to systemd")
+	}
+	defer conn.Close()
+
+	if _, err := conn.Write([]byte(state)); err != nil {
+		return nerr.Translate(err).Addf("unable to send %s to systemd", state)
+	}
+
+	return nil
+}
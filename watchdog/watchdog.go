@@ -0,0 +1,311 @@
+package watchdog
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/byuoitav/common/log"
+	"github.com/byuoitav/common/nerr"
+	"github.com/byuoitav/device-monitoring/actions/reboot"
+	"github.com/byuoitav/device-monitoring/audit"
+)
+
+const (
+	defaultInterval    = 5 * time.Second
+	defaultGrace       = time.Minute
+	defaultMaxResets   = 3
+	defaultResetWindow = 24 * time.Hour
+	checkTimeout       = 10 * time.Second
+)
+
+// Config controls how the watchdog is fed
+type Config struct {
+	// Device is the hardware watchdog to feed (ie, /dev/watchdog). if it's empty, only systemd is notified
+	Device string
+
+	// Interval is how often the checks run and the watchdogs are fed. it's shortened to half of systemd's watchdog timeout if needed
+	Interval time.Duration
+
+	// Grace is how long the checks must fail before the watchdogs stop being fed
+	Grace time.Duration
+
+	// MaxResets is the most times the hardware watchdog may reset the device in ResetWindow.
+	// once it has, the hardware watchdog keeps being fed so that the device isn't rebooted over and over. they default to 3 and 24h
+	MaxResets   int
+	ResetWindow time.Duration
+}
+
+// Check is something that must be healthy for the watchdogs to be fed
+type Check struct {
+	Name  string
+	Check func(ctx context.Context) error
+
+	// SystemdOnly means a failure only stops systemd's watchdog (restarting this service), not the hardware watchdog.
+	// it's for things that rebooting the device won't fix (ie, the hub being down)
+	SystemdOnly bool
+}
+
+// Status is the state of the watchdog
+type Status struct {
+	Device    string            `json:"device,omitempty"`
+	Systemd   bool              `json:"systemd"`
+	Healthy   bool              `json:"healthy"`
+	Failures  map[string]string `json:"failures,omitempty"`
+	FailingAt *time.Time        `json:"failing-since,omitempty"`
+	LastFed   time.Time         `json:"last-fed,omitempty"`
+	Stopped   bool              `json:"stopped"`
+
+	// SystemdStopped is true once systemd is no longer notified, so that it restarts this service
+	SystemdStopped bool `json:"systemd-stopped"`
+
+	// ResetsExhausted is true if the hardware watchdog should have reset the device, but it already has MaxResets times
+	ResetsExhausted bool `json:"resets-exhausted"`
+}
+
+var (
+	status   Status
+	statusMu sync.RWMutex
+)
+
+// GetStatus returns the state of the watchdog
+func GetStatus() Status {
+	statusMu.RLock()
+	defer statusMu.RUnlock()
+
+	s := status
+	return s
+}
+
+// Run feeds the hardware watchdog and notifies systemd as long as every check passes, until ctx is cancelled.
+// once the checks have been failing for config.Grace, systemd is no longer notified, so it restarts this service.
+// if any of them aren't SystemdOnly, the reason is saved and the hardware watchdog is no longer fed either, so it reboots the device
+// (unless it has already reset the device config.MaxResets times in config.ResetWindow).
+func Run(ctx context.Context, config Config, checks []Check) *nerr.E {
+	if config.Interval <= 0 {
+		config.Interval = defaultInterval
+	}
+
+	if config.Grace <= 0 {
+		config.Grace = defaultGrace
+	}
+
+	if config.MaxResets <= 0 {
+		config.MaxResets = defaultMaxResets
+	}
+
+	if config.ResetWindow <= 0 {
+		config.ResetWindow = defaultResetWindow
+	}
+
+	systemdTimeout, systemd := systemdWatchdog()
+	if systemd && systemdTimeout/2 < config.Interval {
+		config.Interval = systemdTimeout / 2
+	}
+
+	var dev *os.File
+	if len(config.Device) > 0 {
+		var err error
+
+		dev, err = os.OpenFile(config.Device, os.O_WRONLY, 0)
+		if err != nil {
+			return nerr.Translate(err).Addf("unable to open watchdog %s", config.Device)
+		}
+
+		defer func() {
+			// the magic close character disables the watchdog, so that it doesn't reboot the device after a clean exit
+			if _, err := dev.Write([]byte("V")); err != nil {
+				log.L.Warnf("unable to disable watchdog %s: %s", config.Device, err)
+			}
+
+			dev.Close()
+		}()
+	}
+
+	if !systemd && dev == nil {
+		return nerr.Create("no hardware watchdog was configured, and systemd's watchdog isn't enabled", "invalid")
+	}
+
+	statusMu.Lock()
+	status = Status{
+		Device:  config.Device,
+		Systemd: systemd,
+		Healthy: true,
+	}
+	statusMu.Unlock()
+
+	if systemd {
+		if err := notify("READY=1"); err != nil {
+			log.L.Warnf("unable to notify systemd: %s", err.Error())
+		}
+	}
+
+	log.L.Infof("Starting watchdog (device: %q, systemd: %v, interval: %v, grace: %v, max resets: %d per %v)",
+		config.Device, systemd, config.Interval, config.Grace, config.MaxResets, config.ResetWindow)
+
+	ticker := time.NewTicker(config.Interval)
+	defer ticker.Stop()
+
+	systemdOnly := make(map[string]bool)
+	for _, check := range checks {
+		systemdOnly[check.Name] = check.SystemdOnly
+	}
+
+	// failingSince is when any check started failing, and deviceFailingSince is when one that the hardware watchdog cares about did
+	var failingSince, deviceFailingSince time.Time
+	notifying := systemd
+
+	for {
+		failures := runChecks(ctx, checks)
+		now := time.Now()
+
+		deviceFailing := false
+		for name := range failures {
+			deviceFailing = deviceFailing || !systemdOnly[name]
+		}
+
+		switch {
+		case len(failures) == 0:
+			failingSince = time.Time{}
+		case failingSince.IsZero():
+			failingSince = now
+			log.L.Warnf("watchdog checks are failing: %v", failures)
+		}
+
+		switch {
+		case !deviceFailing:
+			deviceFailingSince = time.Time{}
+		case deviceFailingSince.IsZero():
+			deviceFailingSince = now
+		}
+
+		stopSystemd := notifying && !failingSince.IsZero() && now.Sub(failingSince) >= config.Grace
+		stopDevice := dev != nil && !deviceFailingSince.IsZero() && now.Sub(deviceFailingSince) >= config.Grace
+
+		exhausted := false
+		if stopDevice {
+			resets, err := reboot.WatchdogResets(now.Add(-config.ResetWindow))
+			if err != nil {
+				log.L.Warnf("%s", err.Error())
+			}
+
+			if resets >= config.MaxResets {
+				stopDevice = false
+				exhausted = true
+			}
+		}
+
+		statusMu.Lock()
+		status.Healthy = len(failures) == 0
+		status.Failures = failures
+		status.FailingAt = nil
+		if !failingSince.IsZero() {
+			t := failingSince
+			status.FailingAt = &t
+		}
+
+		if exhausted && !status.ResetsExhausted {
+			log.L.Errorf("the hardware watchdog has already reset the device %d times in %v; not resetting it again", config.MaxResets, config.ResetWindow)
+		}
+
+		status.ResetsExhausted = exhausted
+		statusMu.Unlock()
+
+		if stopDevice {
+			reason := fmt.Sprintf("watchdog checks failed for %v: %s", now.Sub(deviceFailingSince).Truncate(time.Second), summarize(failures))
+			log.L.Errorf("%s; no longer feeding the watchdog", reason)
+
+			audit.Record("watchdog-reset", reboot.WatchdogRequester, map[string]string{"reason": reason}, nil)
+
+			if err := reboot.RecordWatchdog(reason); err != nil {
+				log.L.Warnf("%s", err.Error())
+			}
+
+			statusMu.Lock()
+			status.Stopped = true
+			statusMu.Unlock()
+
+			// wait to be restarted or rebooted
+			<-ctx.Done()
+			return nil
+		}
+
+		if stopSystemd {
+			reason := fmt.Sprintf("watchdog checks failed for %v: %s", now.Sub(failingSince).Truncate(time.Second), summarize(failures))
+			log.L.Errorf("%s; no longer notifying systemd", reason)
+
+			audit.Record("watchdog-restart", reboot.WatchdogRequester, map[string]string{"reason": reason}, nil)
+			notifying = false
+
+			statusMu.Lock()
+			status.SystemdStopped = true
+			statusMu.Unlock()
+		}
+
+		if dev != nil {
+			if _, err := dev.Write([]byte{0}); err != nil {
+				log.L.Warnf("unable to feed watchdog %s: %s", config.Device, err)
+			}
+		}
+
+		if notifying {
+			if err := notify("WATCHDOG=1"); err != nil {
+				log.L.Warnf("unable to notify systemd: %s", err.Error())
+			}
+		}
+
+		statusMu.Lock()
+		status.LastFed = now
+		statusMu.Unlock()
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// runChecks runs every check in parallel, and returns the error from each one that failed
+func runChecks(ctx context.Context, checks []Check) map[string]string {
+	ctx, cancel := context.WithTimeout(ctx, checkTimeout)
+	defer cancel()
+
+	var failures map[string]string
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+
+	for _, check := range checks {
+		wg.Add(1)
+
+		go func(check Check) {
+			defer wg.Done()
+
+			if err := check.Check(ctx); err != nil {
+				mu.Lock()
+				defer mu.Unlock()
+
+				if failures == nil {
+					failures = make(map[string]string)
+				}
+
+				failures[check.Name] = err.Error()
+			}
+		}(check)
+	}
+
+	wg.Wait()
+	return failures
+}
+
+func summarize(failures map[string]string) string {
+	var s []string
+	for name, err := range failures {
+		s = append(s, fmt.Sprintf("%s (%s)", name, err))
+	}
+
+	return strings.Join(s, ", ")
+}